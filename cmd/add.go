@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/resolver"
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add <target>[@revision]",
+	Short: "Add or update a dependency in protodep.toml",
+	Long: `Add a dependency to protodep.toml, or update it when the target is already there.
+
+The revision is a tag or a commit hash, or a version range like ^1.2.0. Without a
+revision and --branch, the default branch of the remote repository is tracked.
+protodep.toml is edited in place, keeping its comments and formatting. Then the
+dependency is vendored and protodep.lock is updated for this entry only.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		isUp, err := cmd.Flags().GetBool("up")
+		if err != nil {
+			return err
+		}
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		doc, err := loadProtodepToml(pwd)
+		if err != nil {
+			return err
+		}
+
+		conf, err := newResolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := commandContext(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		updateService, err := resolver.New(conf)
+		if err != nil {
+			return err
+		}
+
+		path, err := cmd.Flags().GetString("path")
+		if err != nil {
+			return err
+		}
+
+		target, revision := splitRevision(args[0])
+		index := doc.Find(target, path)
+
+		dep := config.ProtoDepDependency{Target: target, Path: path}
+		if index >= 0 {
+			dep = doc.Config().Dependencies[index]
+		}
+		if err := applyDependencyFlags(cmd, &dep, revision); err != nil {
+			return err
+		}
+
+		if index < 0 && dep.SourceKind() == config.SourceGit && dep.Revision == "" && dep.Version == "" && dep.Branch == "" {
+			branch, err := updateService.DefaultBranch(ctx, dep)
+			if err != nil {
+				return err
+			}
+			logger.Info("default branch of %s is %s", dep.Repository(), branch)
+			dep.Branch = branch
+		}
+
+		if index < 0 {
+			err = doc.AddDependency(dep)
+		} else {
+			err = doc.UpdateDependency(index, dep)
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.Config().Validate(); err != nil {
+			return err
+		}
+
+		if err := doc.Save(); err != nil {
+			return err
+		}
+		if index < 0 {
+			logger.Info("added %s to protodep.toml", dep.Target)
+		} else {
+			logger.Info("updated %s in protodep.toml", dep.Target)
+		}
+
+		if !isUp {
+			return nil
+		}
+
+		_, err = updateService.Resolve(ctx, resolver.Options{
+			ForceUpdate: true,
+			Targets:     []string{resolver.Key(dep)},
+		})
+		return err
+	},
+}
+
+// loadProtodepToml opens protodep.toml in dir for editing.
+func loadProtodepToml(dir string) (*config.Document, error) {
+	tomlPath := filepath.Join(dir, "protodep.toml")
+	if _, err := os.Stat(tomlPath); err != nil {
+		return nil, fmt.Errorf("%s not found, run protodep init first", tomlPath)
+	}
+	return config.LoadDocument(tomlPath)
+}
+
+// splitRevision splits a reference like target@revision.
+func splitRevision(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// applyDependencyFlags sets revision, a tag, commit hash or version range, and the
+// dependency flags that were given on dep.
+func applyDependencyFlags(cmd *cobra.Command, dep *config.ProtoDepDependency, revision string) error {
+	if strings.IndexAny(revision, "^~<>=!") == 0 {
+		dep.Version = revision
+		dep.Revision = ""
+	} else if revision != "" {
+		dep.Revision = revision
+		dep.Version = ""
+	}
+
+	var err error
+	if cmd.Flags().Changed("branch") {
+		if dep.Branch, err = cmd.Flags().GetString("branch"); err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("protocol") {
+		if dep.Protocol, err = cmd.Flags().GetString("protocol"); err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("include") {
+		if dep.Includes, err = cmd.Flags().GetStringSlice("include"); err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("ignore") {
+		if dep.Ignores, err = cmd.Flags().GetStringSlice("ignore"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addDependencyFlags(c *cobra.Command) {
+	c.Flags().StringP("branch", "b", "", "branch to track, the default branch of the remote when empty")
+	c.Flags().StringP("path", "", "", "directory under proto_outdir to vendor into, also identifies the entry to update")
+	c.Flags().StringP("protocol", "", "", "protocol to fetch with, ssh or https")
+	c.Flags().StringSliceP("include", "", nil, "glob of files to vendor, can be repeated")
+	c.Flags().StringSliceP("ignore", "", nil, "glob of files not to vendor, can be repeated")
+}
+
+func initAddCmd() {
+	addDependencyFlags(addCmd)
+	addCmd.Flags().BoolP("up", "", true, "vendor the dependency and update protodep.lock")
+	addAuthFlags(addCmd)
+	addFetchFlags(addCmd)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/resolver"
+)
+
+// addAuthFlags registers the flags used to authenticate against dependency repositories.
+func addAuthFlags(c *cobra.Command) {
+	c.PersistentFlags().StringP("identity-file", "i", "", "set the identity file for SSH")
+	c.PersistentFlags().StringP("password", "p", "", "set the password for SSH")
+	c.PersistentFlags().BoolP("use-https", "u", false, "use HTTPS to get dependencies.")
+	c.PersistentFlags().StringP("basic-auth-username", "", "", "set the username with Basic Auth via HTTPS")
+	c.PersistentFlags().StringP("basic-auth-password", "", "", "set the password or personal access token(when enabled 2FA) with Basic Auth via HTTPS")
+}
+
+// setAuthConfig sets the authentication of conf from the flags registered by addAuthFlags.
+func setAuthConfig(cmd *cobra.Command, conf *resolver.Config) error {
+	identityFile, err := cmd.Flags().GetString("identity-file")
+	if err != nil {
+		return err
+	}
+	logger.Debug("identity file = %s", identityFile)
+
+	password, err := cmd.Flags().GetString("password")
+	if err != nil {
+		return err
+	}
+	if password != "" {
+		logger.Debug("password = %s", strings.Repeat("x", len(password))) // Do not display the password.
+	}
+
+	useHttps, err := cmd.Flags().GetBool("use-https")
+	if err != nil {
+		return err
+	}
+	logger.Debug("use https = %t", useHttps)
+
+	basicAuthUsername, err := cmd.Flags().GetString("basic-auth-username")
+	if err != nil {
+		return err
+	}
+	if basicAuthUsername != "" {
+		logger.Debug("https basic auth username = %s", basicAuthUsername)
+	}
+
+	basicAuthPassword, err := cmd.Flags().GetString("basic-auth-password")
+	if err != nil {
+		return err
+	}
+	if basicAuthPassword != "" {
+		logger.Debug("https basic auth password = %s", strings.Repeat("x", len(basicAuthPassword))) // Do not display the password.
+	}
+
+	conf.UseHttps = useHttps
+	conf.BasicAuthUsername = basicAuthUsername
+	conf.BasicAuthPassword = basicAuthPassword
+	conf.IdentityFile = identityFile
+	conf.IdentityPassword = password
+	return nil
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/resolver"
+)
+
+// addFetchFlags registers the flags that bound how long fetching dependencies may take
+// and how often a failed fetch is retried.
+func addFetchFlags(c *cobra.Command) {
+	c.PersistentFlags().DurationP("timeout", "", 0, "give up the whole command after this duration, e.g. 10m (0 waits forever)")
+	c.PersistentFlags().DurationP("fetch-timeout", "", 0, "give up fetching a single dependency after this duration, e.g. 2m (0 waits forever)")
+	c.PersistentFlags().IntP("retries", "", 2, "retry fetches failing with a timeout, a reset connection or a 5xx response this many times")
+	c.PersistentFlags().DurationP("retry-backoff", "", time.Second, "wait before the first retry, doubled after each retry")
+}
+
+// commandContext returns the context of cmd, canceled after the --timeout flag registered
+// by addFetchFlags.
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(cmd.Context())
+		return ctx, cancel, nil
+	}
+	logger.Debug("timeout = %s", timeout)
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// newResolverConfig builds a resolver.Config for the current directory from the flags
+// registered by addAuthFlags and addFetchFlags.
+func newResolverConfig(cmd *cobra.Command) (*resolver.Config, error) {
+	fetchTimeout, err := cmd.Flags().GetDuration("fetch-timeout")
+	if err != nil {
+		return nil, err
+	}
+	if fetchTimeout > 0 {
+		logger.Debug("fetch timeout = %s", fetchTimeout)
+	}
+
+	retries, err := cmd.Flags().GetInt("retries")
+	if err != nil {
+		return nil, err
+	}
+	retryBackoff, err := cmd.Flags().GetDuration("retry-backoff")
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("retries = %d, retry backoff = %s", retries, retryBackoff)
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &resolver.Config{
+		HomeDir:      homeDir,
+		TargetDir:    pwd,
+		OutputDir:    pwd,
+		FetchTimeout: fetchTimeout,
+		Retries:      retries,
+		RetryBackoff: retryBackoff,
+	}
+	if err := setAuthConfig(cmd, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
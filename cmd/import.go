@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/bufimport"
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Convert the configuration of another tool into protodep.toml",
+}
+
+var importBufCmd = &cobra.Command{
+	Use:   "buf",
+	Short: "Convert buf.yaml and buf.lock into protodep.toml and protodep.lock",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		protoOutdir, err := cmd.Flags().GetString("proto-outdir")
+		if err != nil {
+			return err
+		}
+		logger.Debug("proto-outdir = %s", protoOutdir)
+
+		isForce, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+		logger.Debug("force = %t", isForce)
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		tomlPath := filepath.Join(pwd, "protodep.toml")
+		if _, err := os.Stat(tomlPath); err == nil && !isForce {
+			return fmt.Errorf("%s already exists, pass --force to overwrite it", tomlPath)
+		}
+
+		bufYAML, err := os.ReadFile(filepath.Join(pwd, "buf.yaml"))
+		if err != nil {
+			return fmt.Errorf("read buf.yaml: %w", err)
+		}
+
+		bufLock, err := os.ReadFile(filepath.Join(pwd, "buf.lock"))
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Warn("buf.lock not found, protodep.lock is not written")
+			bufLock = nil
+		} else if err != nil {
+			return fmt.Errorf("read buf.lock: %w", err)
+		}
+
+		result, err := bufimport.Convert(bufYAML, bufLock, protoOutdir)
+		if err != nil {
+			return err
+		}
+
+		for _, warning := range result.Warnings {
+			logger.Warn("%s", warning)
+		}
+
+		if err := config.Write(tomlPath, result.Config); err != nil {
+			return err
+		}
+		logger.Info("wrote %d dependencies to protodep.toml", len(result.Config.Dependencies))
+
+		if result.Lock != nil {
+			if err := config.Write(filepath.Join(pwd, "protodep.lock"), result.Lock); err != nil {
+				return err
+			}
+			logger.Info("wrote protodep.lock, run protodep up to vendor the pinned commits")
+		}
+
+		return nil
+	},
+}
+
+func initImportCmd() {
+	importBufCmd.Flags().StringP("proto-outdir", "", "./proto", "proto_outdir of the generated protodep.toml")
+	importBufCmd.Flags().BoolP("force", "f", false, "overwrite an existing protodep.toml")
+	importCmd.AddCommand(importBufCmd)
+}
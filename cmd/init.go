@@ -1,6 +1,11 @@
 package cmd
 
 func init() {
-	RootCmd.AddCommand(upCmd, versionCmd)
+	RootCmd.AddCommand(initCmd, addCmd, removeCmd, upCmd, outdatedCmd, verifyCmd, importCmd, versionCmd)
 	initDepCmd()
+	initOutdatedCmd()
+	initImportCmd()
+	initInitCmd()
+	initAddCmd()
+	initRemoveCmd()
 }
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create protodep.toml in the current directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		protoOutdir, err := cmd.Flags().GetString("proto-outdir")
+		if err != nil {
+			return err
+		}
+
+		isForce, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		tomlPath := filepath.Join(pwd, "protodep.toml")
+		if _, err := os.Stat(tomlPath); err == nil && !isForce {
+			return fmt.Errorf("%s already exists, pass --force to overwrite it", tomlPath)
+		}
+
+		// Ask for proto_outdir on a terminal, unless it was given as a flag. The prompt goes
+		// to stderr, so that stdout stays valid JSON lines with --output json.
+		if !cmd.Flags().Changed("proto-outdir") && isatty.IsTerminal(os.Stdin.Fd()) {
+			fmt.Fprintf(os.Stderr, "proto_outdir (%s): ", protoOutdir)
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return err
+			}
+			if answer = strings.TrimSpace(answer); answer != "" {
+				protoOutdir = answer
+			}
+		}
+
+		protodep := config.ProtoDep{ProtoOutdir: protoOutdir}
+		if err := protodep.Validate(); err != nil {
+			return err
+		}
+
+		content, err := config.Template(protoOutdir)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(tomlPath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("write to %s: %w", tomlPath, err)
+		}
+
+		logger.Info("created %s", tomlPath)
+		return nil
+	},
+}
+
+func initInitCmd() {
+	initCmd.Flags().StringP("proto-outdir", "", "./proto", "directory the .proto files are vendored into")
+	initCmd.Flags().BoolP("force", "f", false, "overwrite an existing protodep.toml")
+}
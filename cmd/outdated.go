@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/resolver"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "Show dependencies in protodep.lock that have newer upstream revisions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		conf, err := newResolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := commandContext(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		updateService, err := resolver.New(conf)
+		if err != nil {
+			return err
+		}
+
+		deps, err := updateService.Outdated(ctx)
+		if err != nil {
+			return err
+		}
+
+		if logger.IsJSON() {
+			return reportOutdated(deps)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tLOCKED\tBRANCH\tHEAD\tLATEST TAG\tSTATUS")
+
+		outdated := 0
+		for _, dep := range deps {
+			status := "up-to-date"
+			if dep.Behind {
+				status = "outdated"
+				outdated++
+			}
+
+			latestTag := "-"
+			if dep.LatestTag != "" {
+				latestTag = fmt.Sprintf("%s (%s)", dep.LatestTag, shortHash(dep.LatestTagHash))
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				dep.Target, shortHash(dep.Revision), dep.Branch, shortHash(dep.BranchHead), latestTag, status)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if outdated > 0 {
+			return fmt.Errorf("%d of %d dependencies are outdated", outdated, len(deps))
+		}
+		return nil
+	},
+}
+
+func reportOutdated(deps []resolver.OutdatedDependency) error {
+	outdated := 0
+	for _, dep := range deps {
+		if dep.Behind {
+			outdated++
+		}
+		logger.Event(logger.EventUpstream, logger.Fields{
+			"target":          dep.Target,
+			"revision":        dep.Revision,
+			"branch":          dep.Branch,
+			"branch_head":     dep.BranchHead,
+			"latest_tag":      dep.LatestTag,
+			"latest_tag_hash": dep.LatestTagHash,
+			"outdated":        dep.Behind,
+		}, "%s is at %s", dep.Target, dep.Revision)
+	}
+
+	if outdated > 0 {
+		return fmt.Errorf("%d of %d dependencies are outdated", outdated, len(deps))
+	}
+	return nil
+}
+
+func initOutdatedCmd() {
+	addAuthFlags(outdatedCmd)
+	addFetchFlags(outdatedCmd)
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
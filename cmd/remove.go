@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/resolver"
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <target>",
+	Short: "Remove a dependency from protodep.toml",
+	Long: `Remove a dependency from protodep.toml, keeping its other comments and formatting.
+Its vendored files and its entry in protodep.lock are removed as well.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		path, err := cmd.Flags().GetString("path")
+		if err != nil {
+			return err
+		}
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		doc, err := loadProtodepToml(pwd)
+		if err != nil {
+			return err
+		}
+
+		target := args[0]
+		index := doc.Find(target, path)
+		if index < 0 {
+			return fmt.Errorf("%s is not in protodep.toml", target)
+		}
+
+		if err := doc.RemoveDependency(index); err != nil {
+			return err
+		}
+		if err := doc.Save(); err != nil {
+			return err
+		}
+		logger.Info("removed %s from protodep.toml", target)
+
+		if !config.NewDependency(pwd, false).HasLockFile() {
+			return nil
+		}
+
+		conf, err := newResolverConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := commandContext(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		updateService, err := resolver.New(conf)
+		if err != nil {
+			return err
+		}
+
+		// Only the removed entry is dropped, other entries with the same target keep their revisions.
+		_, err = updateService.Resolve(ctx, resolver.Options{
+			ForceUpdate: true,
+			Targets:     []string{resolver.Key(config.ProtoDepDependency{Target: target, Path: path})},
+		})
+		return err
+	},
+}
+
+func initRemoveCmd() {
+	removeCmd.Flags().StringP("path", "", "", "path of the entry to remove, when the target is vendored more than once")
+	addAuthFlags(removeCmd)
+	addFetchFlags(removeCmd)
+}
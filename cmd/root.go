@@ -15,27 +15,86 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/logger"
 )
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "protodep",
 	Short: "Manage vendor for Protocol Buffer IDL file (.proto)",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if err := logger.SetFormat(output); err != nil {
+			return err
+		}
+
+		quiet, err := cmd.Flags().GetBool("quiet")
+		if err != nil {
+			return err
+		}
+		verbose, err := cmd.Flags().GetCount("verbose")
+		if err != nil {
+			return err
+		}
+		switch {
+		case quiet && verbose > 0:
+			return errors.New("--quiet cannot be combined with --verbose")
+		case quiet:
+			logger.SetLevel(slog.LevelWarn)
+		case verbose == 1:
+			logger.SetLevel(slog.LevelDebug)
+		case verbose > 1:
+			logger.SetLevel(logger.LevelTrace)
+		}
+
+		// Errors are printed as events, so that stdout stays valid JSON lines.
+		if logger.IsJSON() {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+		}
+		return nil
+	},
 }
 
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
-		color.Red(err.Error())
+	// Ctrl-C cancels the fetches in progress, which clean up after themselves.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := RootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
+		// Errors already printed as an error event, like a dependency that failed, are not
+		// printed again.
+		if logger.IsReported(err) {
+			os.Exit(-1)
+		}
+		if logger.IsJSON() {
+			logger.Event(logger.EventError, logger.Fields{"error": err.Error()}, "%s", err)
+		} else {
+			color.Red(err.Error())
+		}
 		os.Exit(-1)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	RootCmd.PersistentFlags().StringP("output", "o", logger.FormatText, "output format, text or json")
+	RootCmd.PersistentFlags().BoolP("quiet", "q", false, "print only warnings and errors")
+	RootCmd.PersistentFlags().CountP("verbose", "v", "print debug messages such as skipped files, -vv also every vendored file")
 }
 
 func initConfig() {
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"text/tabwriter"
 
-	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 
 	"github.com/stormcat24/protodep/pkg/logger"
@@ -12,94 +14,191 @@ import (
 )
 
 var upCmd = &cobra.Command{
-	Use:   "up",
+	Use:   "up [target...]",
 	Short: "Populate .proto vendors existing protodep.toml and lock",
+	Long: `Populate .proto vendors existing protodep.toml and lock.
+
+With --force and targets, only those dependencies are resolved to new revisions.
+The other dependencies stay at their revisions in protodep.lock. A target selects
+all its entries, target@path only the entry vendored into path.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		isForceUpdate, err := cmd.Flags().GetBool("force")
 		if err != nil {
 			return err
 		}
-		logger.Info("force update = %t", isForceUpdate)
+		logger.Debug("force update = %t", isForceUpdate)
+
+		if len(args) > 0 && !isForceUpdate {
+			return errors.New("targets can only be updated with --force")
+		}
+		if len(args) > 0 {
+			logger.Debug("targets = %s", strings.Join(args, ", "))
+		}
 
 		isCleanupCache, err := cmd.Flags().GetBool("cleanup")
 		if err != nil {
 			return err
 		}
-		logger.Info("cleanup cache = %t", isCleanupCache)
+		logger.Debug("cleanup cache = %t", isCleanupCache)
 
-		identityFile, err := cmd.Flags().GetString("identity-file")
+		conf, err := newResolverConfig(cmd)
 		if err != nil {
 			return err
 		}
-		logger.Info("identity file = %s", identityFile)
 
-		password, err := cmd.Flags().GetString("password")
+		ctx, cancel, err := commandContext(cmd)
 		if err != nil {
 			return err
 		}
-		if password != "" {
-			logger.Info("password = %s", strings.Repeat("x", len(password))) // Do not display the password.
-		}
+		defer cancel()
 
-		useHttps, err := cmd.Flags().GetBool("use-https")
+		jobs, err := cmd.Flags().GetInt("jobs")
 		if err != nil {
 			return err
 		}
-		logger.Info("use https = %t", useHttps)
+		logger.Debug("jobs = %d", jobs)
+		conf.Jobs = jobs
 
-		basicAuthUsername, err := cmd.Flags().GetString("basic-auth-username")
+		isOffline, err := cmd.Flags().GetBool("offline")
 		if err != nil {
 			return err
 		}
-		if basicAuthUsername != "" {
-			logger.Info("https basic auth username = %s", basicAuthUsername)
-		}
+		logger.Debug("offline = %t", isOffline)
+		conf.Offline = isOffline
 
-		basicAuthPassword, err := cmd.Flags().GetString("basic-auth-password")
+		isStrictImports, err := cmd.Flags().GetBool("strict-imports")
 		if err != nil {
 			return err
 		}
-		if basicAuthPassword != "" {
-			logger.Info("https basic auth password = %s", strings.Repeat("x", len(basicAuthPassword))) // Do not display the password.
+		logger.Debug("strict imports = %t", isStrictImports)
+		conf.StrictImports = isStrictImports
+
+		isDryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
 		}
+		logger.Debug("dry run = %t", isDryRun)
 
-		pwd, err := os.Getwd()
+		isKeepGoing, err := cmd.Flags().GetBool("keep-going")
 		if err != nil {
 			return err
 		}
+		logger.Debug("keep going = %t", isKeepGoing)
 
-		homeDir, err := homedir.Dir()
+		updateService, err := resolver.New(conf)
 		if err != nil {
 			return err
 		}
 
-		conf := resolver.Config{
-			UseHttps:          useHttps,
-			HomeDir:           homeDir,
-			TargetDir:         pwd,
-			OutputDir:         pwd,
-			BasicAuthUsername: basicAuthUsername,
-			BasicAuthPassword: basicAuthPassword,
-			IdentityFile:      identityFile,
-			IdentityPassword:  password,
+		opts := resolver.Options{
+			ForceUpdate:  isForceUpdate,
+			CleanupCache: isCleanupCache,
+			Targets:      args,
+			KeepGoing:    isKeepGoing,
 		}
 
-		updateService, err := resolver.New(&conf)
-		if err != nil {
-			return err
+		if isDryRun {
+			if isCleanupCache {
+				return errors.New("--cleanup cannot be combined with --dry-run")
+			}
+			plan, err := updateService.Plan(ctx, opts)
+			if err != nil {
+				return reportFailures(err)
+			}
+			printPlan(plan)
+			return nil
 		}
 
-		return updateService.Resolve(isForceUpdate, isCleanupCache)
+		_, err = updateService.Resolve(ctx, opts)
+		return reportFailures(err)
 	},
 }
 
+// reportFailures prints a table of the dependencies that failed with --keep-going. Each
+// failure was already reported as an error event in JSON output.
+func reportFailures(err error) error {
+	var depsErr *resolver.DependenciesError
+	if !errors.As(err, &depsErr) {
+		return err
+	}
+
+	if !logger.IsJSON() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tPATH\tERROR")
+		for _, failure := range depsErr.Errors {
+			path := failure.Path
+			if path == "" {
+				path = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", failure.Target, path, strings.ReplaceAll(failure.Err.Error(), "\n", " "))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%d of %d dependencies failed", len(depsErr.Errors), depsErr.Total)
+}
+
+func printPlan(plan *resolver.Plan) {
+	if logger.IsJSON() {
+		for _, dep := range plan.Dependencies {
+			changes := make([]logger.Fields, 0, len(dep.Changes))
+			for _, change := range dep.Changes {
+				changes = append(changes, logger.Fields{"kind": string(change.Kind), "file": change.Path})
+			}
+			logger.Event(logger.EventPlanned, logger.Fields{
+				"target":          dep.Target,
+				"path":            dep.Path,
+				"new":             dep.New,
+				"locked_revision": dep.LockedRevision,
+				"revision":        dep.Revision,
+				"changes":         changes,
+			}, "%s would be resolved to %s", dep.Target, dep.Revision)
+		}
+		for _, change := range plan.Removed {
+			logger.Event(logger.EventPlanned, logger.Fields{"kind": string(change.Kind), "file": change.Path}, "%s would be removed", change.Path)
+		}
+		if plan.LockDiff != "" {
+			logger.Event(logger.EventLockDiff, logger.Fields{"diff": plan.LockDiff}, "protodep.lock would change")
+		}
+		return
+	}
+
+	for _, dep := range plan.Dependencies {
+		revision := shortHash(dep.Revision)
+		switch {
+		case dep.New:
+			revision = strings.TrimSpace(revision + " (new)")
+		case dep.LockedRevision != dep.Revision:
+			revision = shortHash(dep.LockedRevision) + " -> " + revision
+		}
+		fmt.Println(strings.TrimSpace(dep.Target + " " + revision))
+
+		for _, change := range dep.Changes {
+			fmt.Printf("  %-8s %s\n", change.Kind, change.Path)
+		}
+	}
+
+	for _, change := range plan.Removed {
+		fmt.Printf("  %-8s %s\n", change.Kind, change.Path)
+	}
+
+	if plan.LockDiff != "" {
+		fmt.Println()
+		fmt.Print(plan.LockDiff)
+	}
+}
+
 func initDepCmd() {
 	upCmd.PersistentFlags().BoolP("force", "f", false, "update locked file and .proto vendors")
-	upCmd.PersistentFlags().StringP("identity-file", "i", "", "set the identity file for SSH")
-	upCmd.PersistentFlags().StringP("password", "p", "", "set the password for SSH")
 	upCmd.PersistentFlags().BoolP("cleanup", "c", false, "cleanup cache before exec.")
-	upCmd.PersistentFlags().BoolP("use-https", "u", false, "use HTTPS to get dependencies.")
-	upCmd.PersistentFlags().StringP("basic-auth-username", "", "", "set the username with Basic Auth via HTTPS")
-	upCmd.PersistentFlags().StringP("basic-auth-password", "", "", "set the password or personal access token(when enabled 2FA) with Basic Auth via HTTPS")
+	upCmd.PersistentFlags().IntP("jobs", "j", 1, "number of dependencies to resolve concurrently")
+	upCmd.PersistentFlags().BoolP("offline", "", false, "resolve dependencies only from the cache in $HOME/.protodep")
+	upCmd.PersistentFlags().BoolP("strict-imports", "", false, "fail when an import of a vendored file does not resolve")
+	upCmd.PersistentFlags().BoolP("dry-run", "", false, "show the revisions, file changes and protodep.lock diff without writing them")
+	upCmd.PersistentFlags().BoolP("keep-going", "k", false, "resolve the other dependencies when one fails and report every failure")
+	addAuthFlags(upCmd)
+	addFetchFlags(upCmd)
 }
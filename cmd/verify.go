@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/resolver"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that vendored .proto files match protodep.lock",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		pwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		conf := resolver.Config{
+			TargetDir: pwd,
+			OutputDir: pwd,
+		}
+
+		updateService, err := resolver.New(&conf)
+		if err != nil {
+			return err
+		}
+
+		drifts, err := updateService.Verify()
+		if err != nil {
+			return err
+		}
+
+		if len(drifts) > 0 {
+			for _, drift := range drifts {
+				logger.Event(logger.EventDrift, logger.Fields{"kind": string(drift.Kind), "file": drift.Path, "target": drift.Target}, "%-10s %s", drift.Kind, drift.Path)
+			}
+			return fmt.Errorf("%d files do not match protodep.lock", len(drifts))
+		}
+
+		logger.Info("vendored files match protodep.lock")
+		return nil
+	},
+}
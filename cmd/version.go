@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 
+	"github.com/stormcat24/protodep/pkg/logger"
 	"github.com/stormcat24/protodep/version"
 )
 
@@ -20,6 +21,17 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show protodep version",
 	RunE: func(cdm *cobra.Command, args []string) error {
+		if logger.IsJSON() {
+			info := version.Get()
+			logger.Event(logger.EventVersion, logger.Fields{
+				"version":         info.Version,
+				"git_commit":      info.GitCommit,
+				"git_commit_full": info.GitCommitFull,
+				"build_date":      info.BuildDate,
+			}, "%s", info)
+			return nil
+		}
+
 		fmt.Println(art)
 		fmt.Println("")
 		fmt.Println(version.Get())
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -37,7 +38,8 @@ type AuthOption interface {
 
 type AuthProvider interface {
 	GetRepositoryURL(reponame string) string
-	AuthMethod() (transport.AuthMethod, error)
+	// AuthMethod returns the credentials for a fetch. ctx bounds the time spent getting them.
+	AuthMethod(ctx context.Context) (transport.AuthMethod, error)
 }
 
 type AuthProviderWithSSH struct {
@@ -107,7 +109,10 @@ func (p *AuthProviderWithSSH) GetRepositoryURL(reponame string) string {
 	return ep.String()
 }
 
-func (p *AuthProviderWithSSH) AuthMethod() (transport.AuthMethod, error) {
+func (p *AuthProviderWithSSH) AuthMethod(ctx context.Context) (transport.AuthMethod, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	am, err := ssh.NewPublicKeysFromFile("git", p.pemFile, p.password)
 	if err != nil {
 		return nil, err
@@ -123,7 +128,10 @@ func (p *AuthProviderWithSSHAgent) GetRepositoryURL(reponame string) string {
 	return ep.String()
 }
 
-func (p *AuthProviderWithSSHAgent) AuthMethod() (transport.AuthMethod, error) {
+func (p *AuthProviderWithSSHAgent) AuthMethod(ctx context.Context) (transport.AuthMethod, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	aa, err := ssh.NewSSHAgentAuth(ssh.DefaultUsername)
 	if err != nil {
 		panic(err)
@@ -135,7 +143,10 @@ func (p *AuthProviderHTTPS) GetRepositoryURL(reponame string) string {
 	return fmt.Sprintf("https://%s.git", reponame)
 }
 
-func (p *AuthProviderHTTPS) AuthMethod() (transport.AuthMethod, error) {
+func (p *AuthProviderHTTPS) AuthMethod(ctx context.Context) (transport.AuthMethod, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if p.username == "" && p.password == "" {
 		return nil, nil
 	}
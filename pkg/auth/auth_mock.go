@@ -1,10 +1,11 @@
 // Code generated by MockGen. DO NOT EDIT.
 // Source: auth.go
 
-// Package helper is a generated GoMock package.
+// Package auth is a generated GoMock package.
 package auth
 
 import (
+	context "context"
 	reflect "reflect"
 
 	transport "github.com/go-git/go-git/v5/plumbing/transport"
@@ -70,18 +71,18 @@ func (m *MockAuthProvider) EXPECT() *MockAuthProviderMockRecorder {
 }
 
 // AuthMethod mocks base method.
-func (m *MockAuthProvider) AuthMethod() (transport.AuthMethod, error) {
+func (m *MockAuthProvider) AuthMethod(ctx context.Context) (transport.AuthMethod, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AuthMethod")
+	ret := m.ctrl.Call(m, "AuthMethod", ctx)
 	ret0, _ := ret[0].(transport.AuthMethod)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AuthMethod indicates an expected call of AuthMethod.
-func (mr *MockAuthProviderMockRecorder) AuthMethod() *gomock.Call {
+func (mr *MockAuthProviderMockRecorder) AuthMethod(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthMethod", reflect.TypeOf((*MockAuthProvider)(nil).AuthMethod))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthMethod", reflect.TypeOf((*MockAuthProvider)(nil).AuthMethod), ctx)
 }
 
 // GetRepositoryURL mocks base method.
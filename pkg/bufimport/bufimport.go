@@ -0,0 +1,169 @@
+package bufimport
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+// commitPattern matches BSR commit ids, which are dashless UUIDs.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Result is the protodep configuration equivalent to a buf.yaml and buf.lock.
+type Result struct {
+	Config *config.ProtoDep
+	// Lock is nil when there was no buf.lock.
+	Lock *config.ProtoDep
+	// Warnings describe settings of buf.yaml and buf.lock that protodep cannot express.
+	Warnings []string
+}
+
+type bufYAML struct {
+	Version string   `yaml:"version"`
+	Deps    []string `yaml:"deps"`
+}
+
+type bufLock struct {
+	Version string        `yaml:"version"`
+	Deps    []bufLockDeps `yaml:"deps"`
+}
+
+type bufLockDeps struct {
+	// Name is the module name of v2 lock files.
+	Name string `yaml:"name"`
+	// Remote, Owner and Repository are the module name of v1 lock files.
+	Remote     string `yaml:"remote"`
+	Owner      string `yaml:"owner"`
+	Repository string `yaml:"repository"`
+	Commit     string `yaml:"commit"`
+	Digest     string `yaml:"digest"`
+}
+
+func (d bufLockDeps) module() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.Remote + "/" + d.Owner + "/" + d.Repository
+}
+
+// ignoredKeys are buf.yaml keys that do not affect dependencies.
+var ignoredKeys = map[string]bool{
+	"version": true,
+	"deps":    true,
+	"name":    true,
+}
+
+// Convert translates the deps of buf.yaml, pinned by buf.lock when it is not nil, into
+// BSR dependencies vendored into protoOutdir.
+func Convert(bufYAMLContent []byte, bufLockContent []byte, protoOutdir string) (*Result, error) {
+	var conf bufYAML
+	if err := yaml.Unmarshal(bufYAMLContent, &conf); err != nil {
+		return nil, fmt.Errorf("decode buf.yaml: %w", err)
+	}
+	if conf.Version != "v1" && conf.Version != "v2" {
+		return nil, fmt.Errorf("buf.yaml version '%s' is not supported (v1 or v2)", conf.Version)
+	}
+
+	result := &Result{
+		Config: &config.ProtoDep{ProtoOutdir: protoOutdir},
+	}
+
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(bufYAMLContent, &keys); err != nil {
+		return nil, fmt.Errorf("decode buf.yaml: %w", err)
+	}
+	unsupported := make([]string, 0)
+	for key := range keys {
+		if !ignoredKeys[key] {
+			unsupported = append(unsupported, key)
+		}
+	}
+	sort.Strings(unsupported)
+	for _, key := range unsupported {
+		result.warn("buf.yaml: '%s' has no equivalent in protodep.toml and is ignored", key)
+	}
+
+	declared := make(map[string]bool)
+	for _, ref := range conf.Deps {
+		dep, ok := result.parseDep(ref)
+		if !ok {
+			continue
+		}
+		declared[dep.Target] = true
+		result.Config.Dependencies = append(result.Config.Dependencies, dep)
+	}
+
+	if bufLockContent == nil {
+		return result, nil
+	}
+
+	var lock bufLock
+	if err := yaml.Unmarshal(bufLockContent, &lock); err != nil {
+		return nil, fmt.Errorf("decode buf.lock: %w", err)
+	}
+	if lock.Version != "" && lock.Version != "v1" && lock.Version != "v2" {
+		return nil, fmt.Errorf("buf.lock version '%s' is not supported (v1 or v2)", lock.Version)
+	}
+
+	pins := make(map[string]bufLockDeps)
+	for _, pin := range lock.Deps {
+		module := pin.module()
+		pins[module] = pin
+
+		// buf.lock also pins the dependencies of dependencies, which protodep does not
+		// resolve for BSR modules, so they become direct dependencies.
+		if !declared[module] {
+			result.warn("buf.lock: %s is not declared in buf.yaml, added as a direct dependency", module)
+			declared[module] = true
+			result.Config.Dependencies = append(result.Config.Dependencies, config.ProtoDepDependency{
+				Target: module,
+				Source: config.SourceBSR,
+			})
+		}
+	}
+
+	result.Lock = &config.ProtoDep{ProtoOutdir: protoOutdir}
+	for _, dep := range result.Config.Dependencies {
+		pin, ok := pins[dep.Target]
+		if !ok {
+			result.warn("buf.lock: %s is not pinned, protodep up resolves it to the latest commit", dep.Target)
+		} else {
+			dep.Revision = pin.Commit
+			dep.Digest = pin.Digest
+		}
+		result.Lock.Dependencies = append(result.Lock.Dependencies, dep)
+	}
+
+	return result, nil
+}
+
+// parseDep parses a module reference like buf.build/owner/module:ref, where ref is a
+// commit or a label.
+func (r *Result) parseDep(ref string) (config.ProtoDepDependency, bool) {
+	module, version, _ := strings.Cut(ref, ":")
+
+	if len(strings.Split(module, "/")) != 3 {
+		r.warn("buf.yaml: '%s' is not a module reference and is skipped", ref)
+		return config.ProtoDepDependency{}, false
+	}
+
+	dep := config.ProtoDepDependency{
+		Target: module,
+		Source: config.SourceBSR,
+	}
+	if commitPattern.MatchString(version) {
+		dep.Revision = version
+	} else {
+		dep.Branch = version
+	}
+	return dep, true
+}
+
+func (r *Result) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
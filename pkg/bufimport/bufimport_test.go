@@ -0,0 +1,117 @@
+package bufimport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func TestConvertV1(t *testing.T) {
+	bufYAML := `version: v1
+name: buf.build/acme/petapis
+deps:
+  - buf.build/googleapis/googleapis
+  - buf.build/acme/weather:v1
+lint:
+  use:
+    - DEFAULT
+breaking:
+  use:
+    - FILE
+`
+	bufLock := `# Generated by buf. DO NOT EDIT.
+version: v1
+deps:
+  - remote: buf.build
+    owner: googleapis
+    repository: googleapis
+    commit: 75b4300737fb4efca0831636be94e517
+    digest: shake256:d5d8e4ffb8c2ee1f4e4b2e1d2b8d06eb0e4c9e3a
+  - remote: buf.build
+    owner: acme
+    repository: weather
+    commit: 7a6bc1e3707148a4b4d1f2e6d7e9c0a1
+  - remote: buf.build
+    owner: acme
+    repository: units
+    commit: 0f3c2d4e5a6b7c8d9e0f1a2b3c4d5e6f
+`
+
+	result, err := Convert([]byte(bufYAML), []byte(bufLock), "./proto")
+	require.NoError(t, err)
+
+	require.Equal(t, &config.ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []config.ProtoDepDependency{
+			{Target: "buf.build/googleapis/googleapis", Source: config.SourceBSR},
+			{Target: "buf.build/acme/weather", Source: config.SourceBSR, Branch: "v1"},
+			{Target: "buf.build/acme/units", Source: config.SourceBSR},
+		},
+	}, result.Config)
+
+	require.Equal(t, &config.ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []config.ProtoDepDependency{
+			{Target: "buf.build/googleapis/googleapis", Source: config.SourceBSR, Revision: "75b4300737fb4efca0831636be94e517", Digest: "shake256:d5d8e4ffb8c2ee1f4e4b2e1d2b8d06eb0e4c9e3a"},
+			{Target: "buf.build/acme/weather", Source: config.SourceBSR, Branch: "v1", Revision: "7a6bc1e3707148a4b4d1f2e6d7e9c0a1"},
+			{Target: "buf.build/acme/units", Source: config.SourceBSR, Revision: "0f3c2d4e5a6b7c8d9e0f1a2b3c4d5e6f"},
+		},
+	}, result.Lock)
+
+	require.Equal(t, []string{
+		"buf.yaml: 'breaking' has no equivalent in protodep.toml and is ignored",
+		"buf.yaml: 'lint' has no equivalent in protodep.toml and is ignored",
+		"buf.lock: buf.build/acme/units is not declared in buf.yaml, added as a direct dependency",
+	}, result.Warnings)
+}
+
+func TestConvertV2(t *testing.T) {
+	bufYAML := `version: v2
+modules:
+  - path: proto
+deps:
+  - buf.build/googleapis/googleapis:75b4300737fb4efca0831636be94e517
+  - buf.build/bufbuild/protovalidate
+  - local/module
+`
+	bufLock := `version: v2
+deps:
+  - name: buf.build/googleapis/googleapis
+    commit: 75b4300737fb4efca0831636be94e517
+    digest: b5:24ed4f13925cf89ea0ae0127fa28540704c7ae14750af027270221b737a1ce658f8014ca2555f6f7fcf95ea84b071d5f
+`
+
+	result, err := Convert([]byte(bufYAML), []byte(bufLock), "./third_party")
+	require.NoError(t, err)
+
+	require.Equal(t, []config.ProtoDepDependency{
+		{Target: "buf.build/googleapis/googleapis", Source: config.SourceBSR, Revision: "75b4300737fb4efca0831636be94e517"},
+		{Target: "buf.build/bufbuild/protovalidate", Source: config.SourceBSR},
+	}, result.Config.Dependencies)
+
+	require.Len(t, result.Lock.Dependencies, 2)
+	require.Equal(t, "b5:24ed4f13925cf89ea0ae0127fa28540704c7ae14750af027270221b737a1ce658f8014ca2555f6f7fcf95ea84b071d5f", result.Lock.Dependencies[0].Digest)
+	require.Empty(t, result.Lock.Dependencies[1].Revision)
+
+	require.Equal(t, []string{
+		"buf.yaml: 'modules' has no equivalent in protodep.toml and is ignored",
+		"buf.yaml: 'local/module' is not a module reference and is skipped",
+		"buf.lock: buf.build/bufbuild/protovalidate is not pinned, protodep up resolves it to the latest commit",
+	}, result.Warnings)
+	require.NoError(t, result.Config.Validate())
+}
+
+func TestConvertWithoutLock(t *testing.T) {
+	result, err := Convert([]byte("version: v1\ndeps:\n  - buf.build/googleapis/googleapis\n"), nil, "./proto")
+	require.NoError(t, err)
+	require.Len(t, result.Config.Dependencies, 1)
+	require.Nil(t, result.Lock)
+	require.Empty(t, result.Warnings)
+}
+
+func TestConvertUnsupportedVersion(t *testing.T) {
+	_, err := Convert([]byte("version: v1beta1\n"), nil, "./proto")
+	require.Error(t, err)
+}
@@ -10,6 +10,8 @@ import (
 
 type Dependency interface {
 	Load() (*ProtoDep, error)
+	LoadLock() (*ProtoDep, error)
+	HasLockFile() bool
 	IsNeedWriteLockFile() bool
 }
 
@@ -38,6 +40,18 @@ func (d *DependencyImpl) Load() (*ProtoDep, error) {
 		targetConfig = d.lockPath
 	}
 
+	return d.load(targetConfig)
+}
+
+// LoadLock loads protodep.lock regardless of the force update setting.
+func (d *DependencyImpl) LoadLock() (*ProtoDep, error) {
+	if !d.HasLockFile() {
+		return nil, fmt.Errorf("%s not found, run protodep up first", d.lockPath)
+	}
+	return d.load(d.lockPath)
+}
+
+func (d *DependencyImpl) load(targetConfig string) (*ProtoDep, error) {
 	content, err := os.ReadFile(targetConfig)
 	if err != nil {
 		return nil, fmt.Errorf("load %s: %w", targetConfig, err)
@@ -55,11 +69,11 @@ func (d *DependencyImpl) Load() (*ProtoDep, error) {
 	return &conf, nil
 }
 
-func (d *DependencyImpl) hasLockFile() bool {
+func (d *DependencyImpl) HasLockFile() bool {
 	_, err := os.Stat(d.lockPath)
 	return err == nil
 }
 
 func (d *DependencyImpl) IsNeedWriteLockFile() bool {
-	return d.forceUpdate || !d.hasLockFile()
+	return d.forceUpdate || !d.HasLockFile()
 }
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	// emptyValue matches the lines of unset string and array fields in encoded dependencies.
+	emptyValue = regexp.MustCompile(`^\s*\w+ = (""|\[\])$`)
+
+	dependenciesHeader = regexp.MustCompile(`^\s*\[\[\s*dependencies\s*\]\]\s*(#.*)?$`)
+	keyValue           = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+)\s*=`)
+)
+
+// Template returns the content of a new protodep.toml.
+func Template(protoOutdir string) (string, error) {
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(map[string]string{"proto_outdir": protoOutdir}); err != nil {
+		return "", fmt.Errorf("encode config to toml format: %w", err)
+	}
+
+	return buffer.String() + `
+# Add dependencies with "protodep add <target>[@revision]", or write them here:
+#
+# [[dependencies]]
+#   target = "github.com/protocolbuffers/protobuf/src"
+#   branch = "main"
+#   includes = ["/google/protobuf/*.proto"]
+`, nil
+}
+
+// FormatDependency encodes dep as a [[dependencies]] table, leaving out unset fields.
+func FormatDependency(dep ProtoDepDependency) (string, error) {
+	var buffer bytes.Buffer
+	wrapper := struct {
+		Dependencies []ProtoDepDependency `toml:"dependencies"`
+	}{[]ProtoDepDependency{dep}}
+	if err := toml.NewEncoder(&buffer).Encode(wrapper); err != nil {
+		return "", fmt.Errorf("encode dependency to toml format: %w", err)
+	}
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n") {
+		if !emptyValue.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// Document is a protodep.toml edited line by line, so that comments and formatting
+// outside of the edited values are kept.
+type Document struct {
+	path  string
+	lines []string
+	conf  ProtoDep
+}
+
+// LoadDocument reads the TOML file at path for editing.
+func LoadDocument(path string) (*Document, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	d := &Document{
+		path:  path,
+		lines: strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"),
+	}
+	if len(content) == 0 {
+		d.lines = nil
+	}
+	if err := d.decode(); err != nil {
+		return nil, err
+	}
+	if len(d.headers()) != len(d.conf.Dependencies) {
+		return nil, fmt.Errorf("%s: only dependencies written as [[dependencies]] tables can be edited", path)
+	}
+	return d, nil
+}
+
+// Config returns the configuration as currently edited.
+func (d *Document) Config() *ProtoDep {
+	return &d.conf
+}
+
+// Find returns the index of the dependency with target and path, or -1.
+func (d *Document) Find(target string, path string) int {
+	for i, dep := range d.conf.Dependencies {
+		if dep.Target == target && dep.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddDependency appends dep as a new [[dependencies]] table.
+func (d *Document) AddDependency(dep ProtoDepDependency) error {
+	table, err := FormatDependency(dep)
+	if err != nil {
+		return err
+	}
+
+	if len(d.lines) > 0 && strings.TrimSpace(d.lines[len(d.lines)-1]) != "" {
+		d.lines = append(d.lines, "")
+	}
+	d.lines = append(d.lines, strings.Split(strings.TrimSuffix(table, "\n"), "\n")...)
+	return d.decode()
+}
+
+// UpdateDependency rewrites the values of the i-th dependency that differ from dep.
+// Unset values are removed, new ones are added after the last value of the table.
+func (d *Document) UpdateDependency(i int, dep ProtoDepDependency) error {
+	current := reflect.ValueOf(d.conf.Dependencies[i])
+	updated := reflect.ValueOf(dep)
+	typ := current.Type()
+
+	for f := 0; f < typ.NumField(); f++ {
+		key := strings.Split(typ.Field(f).Tag.Get("toml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if reflect.DeepEqual(current.Field(f).Interface(), updated.Field(f).Interface()) {
+			continue
+		}
+		if err := d.setValue(i, key, updated.Field(f)); err != nil {
+			return err
+		}
+	}
+	return d.decode()
+}
+
+// RemoveDependency removes the i-th [[dependencies]] table with the comments right above
+// it. Comments right above the next table are kept, since they describe that one.
+func (d *Document) RemoveDependency(i int) error {
+	start, end := d.table(i)
+	above := start
+	for above > 0 && strings.HasPrefix(strings.TrimSpace(d.lines[above-1]), "#") {
+		above--
+	}
+	if above == 0 || strings.TrimSpace(d.lines[above-1]) == "" {
+		start = above
+	}
+	for end > start+1 && strings.HasPrefix(strings.TrimSpace(d.lines[end-1]), "#") {
+		end--
+	}
+	for end < len(d.lines) && strings.TrimSpace(d.lines[end]) == "" && (end+1 == len(d.lines) || strings.TrimSpace(d.lines[end+1]) == "") {
+		end++
+	}
+
+	lines := append([]string{}, d.lines[:start]...)
+	d.lines = append(lines, d.lines[end:]...)
+	for len(d.lines) > 0 && strings.TrimSpace(d.lines[len(d.lines)-1]) == "" {
+		d.lines = d.lines[:len(d.lines)-1]
+	}
+	return d.decode()
+}
+
+// Save writes the document back to its file.
+func (d *Document) Save() error {
+	content := strings.Join(d.lines, "\n") + "\n"
+	return writeFile(d.path, []byte(content))
+}
+
+// decode parses the edited lines again, so a broken edit is never saved.
+func (d *Document) decode() error {
+	var conf ProtoDep
+	if _, err := toml.Decode(strings.Join(d.lines, "\n"), &conf); err != nil {
+		return fmt.Errorf("decode %s: %w", d.path, err)
+	}
+	d.conf = conf
+	return nil
+}
+
+// setValue replaces, adds or removes key in the i-th dependency table.
+func (d *Document) setValue(i int, key string, value reflect.Value) error {
+	start, end := d.table(i)
+	continued := continuationLines(d.lines)
+
+	first, last := -1, -1
+	lastValue := start
+	indent := "  "
+	for n := start + 1; n < end; n++ {
+		if continued[n] {
+			lastValue = n
+			continue
+		}
+		m := keyValue.FindStringSubmatch(d.lines[n])
+		if m == nil {
+			continue
+		}
+		if lastValue == start {
+			indent = m[1]
+		}
+		lastValue = n
+		if m[2] == key {
+			first, last = n, n
+			for last+1 < end && continued[last+1] {
+				last++
+			}
+		}
+	}
+
+	var replacement []string
+	if !value.IsZero() && !(value.Kind() == reflect.Slice && value.Len() == 0) {
+		var buffer bytes.Buffer
+		if err := toml.NewEncoder(&buffer).Encode(map[string]interface{}{key: value.Interface()}); err != nil {
+			return fmt.Errorf("encode %s: %w", key, err)
+		}
+		line := indent + strings.TrimSuffix(buffer.String(), "\n")
+		if first >= 0 && first == last {
+			if comment := trailingComment(d.lines[first]); comment != "" {
+				line += " " + comment
+			}
+		}
+		replacement = []string{line}
+	}
+
+	if first < 0 {
+		if replacement == nil {
+			return nil
+		}
+		first, last = lastValue+1, lastValue
+	}
+
+	lines := append([]string{}, d.lines[:first]...)
+	lines = append(lines, replacement...)
+	d.lines = append(lines, d.lines[last+1:]...)
+	return nil
+}
+
+// headers returns the line numbers of the [[dependencies]] table headers.
+func (d *Document) headers() []int {
+	continued := continuationLines(d.lines)
+	headers := make([]int, 0)
+	for n, line := range d.lines {
+		if !continued[n] && dependenciesHeader.MatchString(line) {
+			headers = append(headers, n)
+		}
+	}
+	return headers
+}
+
+// table returns the lines of the i-th dependency table, from its header up to the next
+// table header or the end of the document.
+func (d *Document) table(i int) (int, int) {
+	continued := continuationLines(d.lines)
+	start := d.headers()[i]
+	end := start + 1
+	for end < len(d.lines) && (continued[end] || !strings.HasPrefix(strings.TrimSpace(d.lines[end]), "[")) {
+		end++
+	}
+	return start, end
+}
+
+// continuationLines reports for each line whether it continues a multi-line array, inline
+// table or string started on a previous line.
+func continuationLines(lines []string) []bool {
+	continued := make([]bool, len(lines))
+	depth := 0
+	multiline := ""
+
+	for n, line := range lines {
+		continued[n] = depth > 0 || multiline != ""
+		if !continued[n] && strings.HasPrefix(strings.TrimSpace(line), "[") {
+			continue
+		}
+
+		for i := 0; i < len(line); i++ {
+			if multiline != "" {
+				if strings.HasPrefix(line[i:], multiline) {
+					i += len(multiline) - 1
+					multiline = ""
+				} else if multiline == `"""` && line[i] == '\\' {
+					i++
+				}
+				continue
+			}
+
+			switch c := line[i]; {
+			case c == '#':
+				i = len(line)
+			case strings.HasPrefix(line[i:], `"""`) || strings.HasPrefix(line[i:], `'''`):
+				multiline = line[i : i+3]
+				i += 2
+			case c == '"' || c == '\'':
+				for i++; i < len(line) && line[i] != c; i++ {
+					if c == '"' && line[i] == '\\' {
+						i++
+					}
+				}
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			}
+		}
+	}
+	return continued
+}
+
+// trailingComment returns the comment at the end of a single line key/value pair.
+func trailingComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case '#':
+			return line[i:]
+		case '"', '\'':
+			for i++; i < len(line) && line[i] != c; i++ {
+				if c == '"' && line[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	content, err := Template("./proto")
+	require.NoError(t, err)
+
+	var conf ProtoDep
+	_, err = toml.Decode(content, &conf)
+	require.NoError(t, err)
+	require.Equal(t, "./proto", conf.ProtoOutdir)
+	require.Empty(t, conf.Dependencies)
+}
+
+func TestFormatDependency(t *testing.T) {
+	table, err := FormatDependency(ProtoDepDependency{
+		Target:   "github.com/protocolbuffers/protobuf/src",
+		Branch:   "main",
+		Includes: []string{"/google/protobuf/*.proto"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `[[dependencies]]
+  target = "github.com/protocolbuffers/protobuf/src"
+  branch = "main"
+  includes = ["/google/protobuf/*.proto"]
+`, table)
+}
+
+const editedToml = `# our protos
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream" # the v1 API
+  revision = "v1.0.0" # pinned until the v2 migration
+  includes = [
+    "/api/v1/*.proto", # public API
+    "/api/v1/internal/*.proto",
+  ]
+
+# catalog moves fast, track the branch
+[[dependencies]]
+  target = "github.com/stormcat24/catalog"
+  branch = "main"`
+
+func loadTestDocument(t *testing.T, content string) *Document {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "protodep.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	doc, err := LoadDocument(path)
+	require.NoError(t, err)
+	return doc
+}
+
+func savedContent(t *testing.T, doc *Document) string {
+	t.Helper()
+
+	require.NoError(t, doc.Save())
+	content, err := os.ReadFile(doc.path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestDocumentAddDependency(t *testing.T) {
+	doc := loadTestDocument(t, editedToml)
+	require.NoError(t, doc.AddDependency(ProtoDepDependency{Target: "github.com/stormcat24/models", Branch: "main"}))
+	require.Len(t, doc.Config().Dependencies, 3)
+
+	require.Equal(t, editedToml+`
+
+[[dependencies]]
+  target = "github.com/stormcat24/models"
+  branch = "main"
+`, savedContent(t, doc))
+}
+
+func TestDocumentUpdateDependency(t *testing.T) {
+	doc := loadTestDocument(t, editedToml)
+
+	i := doc.Find("github.com/stormcat24/upstream", "")
+	require.Equal(t, 0, i)
+
+	dep := doc.Config().Dependencies[i]
+	dep.Revision = "v1.1.0"
+	dep.Includes = nil
+	dep.Path = "upstream"
+	require.NoError(t, doc.UpdateDependency(i, dep))
+
+	require.Equal(t, `# our protos
+proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream" # the v1 API
+  revision = "v1.1.0" # pinned until the v2 migration
+  path = "upstream"
+
+# catalog moves fast, track the branch
+[[dependencies]]
+  target = "github.com/stormcat24/catalog"
+  branch = "main"
+`, savedContent(t, doc))
+	require.Equal(t, "upstream", doc.Config().Dependencies[0].Path)
+	require.Equal(t, -1, doc.Find("github.com/stormcat24/upstream", ""))
+}
+
+func TestDocumentRemoveDependency(t *testing.T) {
+	doc := loadTestDocument(t, editedToml)
+	require.NoError(t, doc.RemoveDependency(0))
+
+	require.Equal(t, `# our protos
+proto_outdir = "./proto"
+
+# catalog moves fast, track the branch
+[[dependencies]]
+  target = "github.com/stormcat24/catalog"
+  branch = "main"
+`, savedContent(t, doc))
+
+	require.NoError(t, doc.RemoveDependency(0))
+	require.Equal(t, `# our protos
+proto_outdir = "./proto"
+`, savedContent(t, doc))
+}
+
+func TestLoadDocumentInlineDependencies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "protodep.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`proto_outdir = "./proto"
+dependencies = [{ target = "github.com/stormcat24/catalog" }]
+`), 0644))
+
+	_, err := LoadDocument(path)
+	require.ErrorContains(t, err, "only dependencies written as [[dependencies]] tables can be edited")
+}
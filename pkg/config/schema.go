@@ -2,11 +2,42 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+
+	"github.com/stormcat24/protodep/pkg/semver"
+)
+
+// Strategies to resolve conflicting revisions of the same repository between transitive dependencies.
+const (
+	// ConflictError fails the resolution. This is the default.
+	ConflictError = "error"
+	// ConflictHighest picks the highest semver revision.
+	ConflictHighest = "highest"
+	// ConflictFirstWins keeps the revision that was found first, top-level dependencies first.
+	ConflictFirstWins = "first-wins"
+)
+
+// Kinds of sources a dependency can be vendored from.
+const (
+	// SourceGit clones a git repository. This is the default.
+	SourceGit = "git"
+	// SourceArchive downloads a .tar.gz or .zip archive from URL.
+	SourceArchive = "archive"
+	// SourceLocal copies a directory on disk, such as a sibling in a monorepo.
+	SourceLocal = "local"
+	// SourceBSR downloads a module from a Buf Schema Registry, like buf.build/googleapis/googleapis.
+	SourceBSR = "bsr"
 )
 
 type ProtoDep struct {
-	ProtoOutdir  string               `toml:"proto_outdir"`
+	ProtoOutdir string `toml:"proto_outdir"`
+	// Transitive also resolves the dependencies declared in protodep.toml of each dependency.
+	Transitive bool `toml:"transitive,omitempty"`
+	// ConflictStrategy is one of ConflictError, ConflictHighest or ConflictFirstWins.
+	ConflictStrategy string `toml:"conflict_strategy,omitempty"`
+	// ImportPaths are extra directories, relative to protodep.toml, where imports of vendored files may resolve.
+	ImportPaths  []string             `toml:"import_paths,omitempty"`
 	Dependencies []ProtoDepDependency `toml:"dependencies"`
 }
 
@@ -14,6 +45,37 @@ func (d *ProtoDep) Validate() error {
 	if strings.TrimSpace(d.ProtoOutdir) == "" {
 		return errors.New("required 'proto_outdir'")
 	}
+	switch d.ConflictStrategy {
+	case "", ConflictError, ConflictHighest, ConflictFirstWins:
+	default:
+		return fmt.Errorf("unknown conflict_strategy '%s' (%s, %s or %s)", d.ConflictStrategy, ConflictError, ConflictHighest, ConflictFirstWins)
+	}
+	for _, dep := range d.Dependencies {
+		if strings.TrimSpace(dep.Target) == "" {
+			return errors.New("required 'target' in dependencies")
+		}
+		switch dep.SourceKind() {
+		case SourceGit, SourceLocal:
+		case SourceArchive:
+			if strings.TrimSpace(dep.URL) == "" {
+				return fmt.Errorf("%s: required 'url' for archive source", dep.Target)
+			}
+		case SourceBSR:
+			if len(strings.Split(dep.Target, "/")) != 3 {
+				return fmt.Errorf("%s: bsr target must be like buf.build/<owner>/<module>", dep.Target)
+			}
+		default:
+			return fmt.Errorf("%s: unknown source '%s' (%s, %s, %s or %s)", dep.Target, dep.Source, SourceGit, SourceArchive, SourceLocal, SourceBSR)
+		}
+		if dep.ResolveImports && len(dep.Includes) == 0 {
+			return fmt.Errorf("%s: 'resolve_imports' requires 'includes' to name the entry points", dep.Target)
+		}
+		if dep.Version != "" {
+			if _, err := semver.ParseConstraint(dep.Version); err != nil {
+				return fmt.Errorf("%s: %w", dep.Target, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -26,6 +88,46 @@ type ProtoDepDependency struct {
 	Ignores  []string `toml:"ignores"`
 	Includes []string `toml:"includes"`
 	Protocol string   `toml:"protocol"`
+	// Source is one of SourceGit, SourceArchive, SourceLocal or SourceBSR. For local sources
+	// Target is a directory, relative to protodep.toml. For BSR sources Branch is a label and
+	// Revision a commit.
+	Source string `toml:"source,omitempty"`
+	// URL is the location of an archive source, or overrides the registry address of a BSR source.
+	URL string `toml:"url,omitempty"`
+	// SHA256 pins the content of an archive source. It is written to protodep.lock when empty.
+	SHA256 string `toml:"sha256,omitempty"`
+	// Subdir is the directory inside an archive or module that contains the .proto files.
+	Subdir string `toml:"subdir,omitempty"`
+	// Digest is the module digest reported by the registry for a BSR source. It is only written to protodep.lock.
+	Digest string `toml:"digest,omitempty"`
+	// ResolveImports treats Includes as entry points and only vendors the files they import, transitively.
+	ResolveImports bool `toml:"resolve_imports,omitempty"`
+	// Version is a semver range resolved to the highest matching tag on force update.
+	Version string `toml:"version,omitempty"`
+	// Tag is the tag Revision or Version was resolved to. It is only written to protodep.lock.
+	Tag string `toml:"tag,omitempty"`
+	// TreeHash is the digest of all Files. It is only written to protodep.lock.
+	TreeHash string `toml:"tree_hash,omitempty"`
+	// Via is the target whose protodep.toml declared this transitive dependency. It is only written to protodep.lock.
+	Via string `toml:"via,omitempty"`
+	// Files are the vendored files with their digests. It is only written to protodep.lock.
+	Files []ProtoDepFile `toml:"files,omitempty"`
+}
+
+// ProtoDepFile is a vendored file recorded in protodep.lock.
+type ProtoDepFile struct {
+	// Path is relative to proto_outdir and always uses forward slashes.
+	Path string `toml:"path"`
+	// Hash is the digest of the file content, like "sha256:<hex>".
+	Hash string `toml:"hash"`
+}
+
+// SourceKind returns the source of the dependency, SourceGit when it is not set.
+func (d *ProtoDepDependency) SourceKind() string {
+	if d.Source == "" {
+		return SourceGit
+	}
+	return d.Source
 }
 
 func (d *ProtoDepDependency) Repository() string {
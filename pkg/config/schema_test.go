@@ -32,3 +32,81 @@ func TestDirectory(t *testing.T) {
 
 	require.Equal(t, "./examples", protruded.Directory())
 }
+
+func TestValidate(t *testing.T) {
+
+	valid := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/google/protobuf", Version: "^1.4.0"},
+		},
+	}
+	require.NoError(t, valid.Validate())
+
+	noOutdir := ProtoDep{}
+	require.Error(t, noOutdir.Validate())
+
+	invalidVersion := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/google/protobuf", Version: "latest"},
+		},
+	}
+	require.Error(t, invalidVersion.Validate())
+}
+
+func TestValidateResolveImports(t *testing.T) {
+
+	withIncludes := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/googleapis/googleapis", Includes: []string{"/google/pubsub/v1/pubsub.proto"}, ResolveImports: true},
+		},
+	}
+	require.NoError(t, withIncludes.Validate())
+
+	withoutIncludes := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/googleapis/googleapis", ResolveImports: true},
+		},
+	}
+	require.Error(t, withoutIncludes.Validate())
+}
+
+func TestValidateSource(t *testing.T) {
+
+	archive := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/example/protos", Source: SourceArchive, URL: "https://example.com/protos.tar.gz"},
+			{Target: "../shared/proto", Source: SourceLocal},
+			{Target: "buf.build/googleapis/googleapis", Source: SourceBSR, Branch: "main"},
+		},
+	}
+	require.NoError(t, archive.Validate())
+
+	invalidModule := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "buf.build/googleapis", Source: SourceBSR},
+		},
+	}
+	require.Error(t, invalidModule.Validate())
+
+	withoutURL := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/example/protos", Source: SourceArchive},
+		},
+	}
+	require.Error(t, withoutURL.Validate())
+
+	unknown := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			{Target: "github.com/example/protos", Source: "svn"},
+		},
+	}
+	require.Error(t, unknown.Validate())
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Write encodes protodep as TOML into dest, like protodep.toml or protodep.lock.
+func Write(dest string, protodep *ProtoDep) error {
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(protodep); err != nil {
+		return fmt.Errorf("encode config to toml format: %w", err)
+	}
+
+	return writeFile(dest, buffer.Bytes())
+}
+
+// writeFile replaces dest with content at once, so it is never left half written.
+func writeFile(dest string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("write to %s: %w", dest, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write to %s: %w", dest, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write to %s: %w", dest, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("write to %s: %w", dest, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("write to %s: %w", dest, err)
+	}
+
+	return nil
+}
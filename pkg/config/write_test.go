@@ -0,0 +1,47 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+
+	config := ProtoDep{
+		ProtoOutdir: "./proto",
+		Dependencies: []ProtoDepDependency{
+			ProtoDepDependency{
+				Target:   "github.com/openfresh/plasma/protobuf",
+				Branch:   "master",
+				Revision: "d7ee1d95b6700756b293b722a1cfd4b905a351ba",
+			},
+			ProtoDepDependency{
+				Target:   "github.com/grpc-ecosystem/grpc-gateway/examples/examplepb",
+				Branch:   "master",
+				Revision: "c6f7a5ac629444a556bb665e389e41b897ebad39",
+			},
+		},
+	}
+
+	destDir := t.TempDir()
+	destFile := filepath.Join(destDir, "protodep.lock")
+
+	require.NoError(t, Write(destFile, &config))
+
+	stat, err := os.Stat(destFile)
+	require.NoError(t, err)
+	require.True(t, !stat.IsDir())
+	require.Equal(t, os.FileMode(0644), stat.Mode().Perm())
+
+	// Only protodep.lock is left, the temporary file was renamed over it.
+	entries, err := os.ReadDir(destDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	actual, err := NewDependency(destDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, config.Dependencies, actual.Dependencies)
+}
@@ -1,54 +1,344 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"github.com/mattn/go-isatty"
+	"io"
+	"log/slog"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// Output formats.
+const (
+	// FormatText prints colored lines for humans. This is the default.
+	FormatText = "text"
+	// FormatJSON prints one JSON object per line, for CI and editor integrations.
+	FormatJSON = "json"
+)
+
+// LevelTrace is below slog.LevelDebug, for messages about every vendored file.
+const LevelTrace = slog.Level(-8)
+
+// Events emitted while resolving dependencies.
+const (
+	EventDependencyStarted  = "dependency_started"
+	EventDependencyFetched  = "dependency_fetched"
+	EventRevisionResolved   = "revision_resolved"
+	EventFileSkipped        = "file_skipped"
+	EventFilesCopied        = "files_copied"
+	EventDependencyFinished = "dependency_finished"
+	EventError              = "error"
+)
+
+// Events emitted by commands reporting results.
+const (
+	EventPlanned  = "planned"
+	EventLockDiff = "lock_diff"
+	EventUpstream = "upstream"
+	EventDrift    = "drift"
+	EventVersion  = "version"
 )
 
+// eventLevels are the levels of events that are not logged at slog.LevelInfo.
+var eventLevels = map[string]slog.Level{
+	EventFileSkipped: slog.LevelDebug,
+	EventError:       slog.LevelError,
+	EventDrift:       slog.LevelError,
+}
+
+// textEventLevels are the levels of events that only repeat other messages in text mode.
+// In JSON mode and with SetHandler they stay at slog.LevelInfo, since consumers follow
+// the progress of every dependency with them.
+var textEventLevels = map[string]slog.Level{
+	EventDependencyFetched:  slog.LevelDebug,
+	EventDependencyFinished: slog.LevelDebug,
+}
+
+// Fields are the structured data of an event.
+type Fields map[string]interface{}
+
+var (
+	mu           sync.Mutex
+	outputFormat           = FormatText
+	level                  = new(slog.LevelVar)
+	output       io.Writer = os.Stdout
+	handler      slog.Handler
+	jsonHandler  slog.Handler
+
+	// writeMu serializes the lines of the text handler, so that messages of concurrent
+	// jobs do not interleave. Handlers of SetHandler serialize their own writes.
+	writeMu sync.Mutex
+
+	// concurrent counts the callers of Concurrent, spinning is set while a spinner is drawn.
+	concurrent int
+	spinning   bool
+)
+
+// SetFormat selects FormatText or FormatJSON.
+func SetFormat(f string) error {
+	if f != FormatText && f != FormatJSON {
+		return fmt.Errorf("unknown output format '%s' (%s or %s)", f, FormatText, FormatJSON)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	outputFormat = f
+	jsonHandler = nil
+	if f == FormatJSON {
+		jsonHandler = slog.NewJSONHandler(output, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: replaceJSONAttr,
+		})
+	}
+	return nil
+}
+
+// IsJSON reports whether the output format is FormatJSON.
+func IsJSON() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return outputFormat == FormatJSON
+}
+
+// SetLevel sets the minimum level of printed messages. The default is slog.LevelInfo.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// SetHandler routes every message to h instead of printing it, for programs using
+// protodep as a library. h decides which levels are enabled. A nil h restores printing.
+func SetHandler(h slog.Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handler = h
+}
+
+func Trace(format string, a ...interface{}) {
+	log(LevelTrace, "", nil, format, a...)
+}
+
+func Debug(format string, a ...interface{}) {
+	log(slog.LevelDebug, "", nil, format, a...)
+}
+
 func Info(format string, a ...interface{}) {
-	color.Green("[INFO] "+format, a...)
+	log(slog.LevelInfo, "", nil, format, a...)
 }
 
 func Warn(format string, a ...interface{}) {
-	color.Yellow("[WARN] "+format, a...)
+	log(slog.LevelWarn, "", nil, format, a...)
 }
 
 func Error(format string, a ...interface{}) {
-	color.Red("[ERROR] "+format, a...)
+	log(slog.LevelError, "", nil, format, a...)
 }
 
-type spinnerWrapper struct {
-	spinner *spinner.Spinner
+// reportedError is an error that was already printed as an error event.
+type reportedError struct {
+	error
 }
 
-func (s *spinnerWrapper) Stop() {
-	if s.spinner != nil {
-		s.spinner.Stop()
+func (e reportedError) Unwrap() error {
+	return e.error
+}
+
+// Reported marks err as printed by an EventError, so that the command does not print it
+// again when it fails with err.
+func Reported(err error) error {
+	return reportedError{err}
+}
+
+// IsReported reports whether err itself was returned by Reported.
+func IsReported(err error) bool {
+	_, ok := err.(reportedError)
+	return ok
+}
+
+// Event logs a step of the resolution. In text mode only the message is printed. In JSON
+// mode and with SetHandler, the event name and fields are attributes of the message.
+func Event(name string, fields Fields, format string, a ...interface{}) {
+	l, ok := eventLevels[name]
+	if !ok {
+		l = slog.LevelInfo
+	}
+	mu.Lock()
+	text := handler == nil && outputFormat == FormatText
+	mu.Unlock()
+	if tl, ok := textEventLevels[name]; ok && text {
+		l = tl
 	}
+	log(l, name, fields, format, a...)
 }
 
-func (s *spinnerWrapper) Finish() {
-	if s.spinner != nil {
-		s.spinner.Stop()
+func log(l slog.Level, event string, fields Fields, format string, a ...interface{}) {
+	h := currentHandler()
+	ctx := context.Background()
+	if !h.Enabled(ctx, l) {
+		return
 	}
-	fmt.Print("\n")
+
+	record := slog.NewRecord(time.Now(), l, fmt.Sprintf(format, a...), 0)
+	if event != "" {
+		record.AddAttrs(slog.String("event", event))
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, fields[key]))
+	}
+
+	// h is called without holding mu, so that a handler may log through this package.
+	h.Handle(ctx, record)
+}
+
+func currentHandler() slog.Handler {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch {
+	case handler != nil:
+		return handler
+	case jsonHandler != nil:
+		return jsonHandler
+	default:
+		return &textHandler{output: output}
+	}
+}
+
+// replaceJSONAttr names the message "message" and writes levels in lower case.
+func replaceJSONAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.LevelKey:
+		if l, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(levelName(l))
+		}
+	}
+	return a
+}
+
+func levelName(l slog.Level) string {
+	if l <= LevelTrace {
+		return "trace"
+	}
+	return strings.ToLower(l.String())
+}
+
+// textHandler prints colored "[LEVEL] message" lines and leaves out attributes.
+type textHandler struct {
+	output io.Writer
+}
+
+func (h *textHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var c *color.Color
+	switch {
+	case r.Level >= slog.LevelError:
+		c = color.New(color.FgRed)
+	case r.Level >= slog.LevelWarn:
+		c = color.New(color.FgYellow)
+	case r.Level >= slog.LevelInfo:
+		c = color.New(color.FgGreen)
+	default:
+		c = color.New(color.FgCyan)
+	}
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	_, err := c.Fprintf(h.output, "[%s] %s\n", strings.ToUpper(levelName(r.Level)), r.Message)
+	return err
 }
 
+func (h *textHandler) WithAttrs(_ []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *textHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+// Concurrent tells the logger that several jobs log at once until done is called. In the
+// meantime InfoWithSpinner prints plain messages, since spinners of concurrent jobs would
+// overwrite each other on the terminal.
+func Concurrent() (done func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	concurrent++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			concurrent--
+		})
+	}
+}
+
+// terminal reports whether w is a terminal, where spinners are drawn.
+var terminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd())
+}
+
+// InfoWithSpinner logs an info message, followed by a spinner until Finish when the text
+// is printed to a terminal. Only one spinner is drawn at a time, the messages of the
+// others are printed plain.
 func InfoWithSpinner(format string, a ...interface{}) *spinnerWrapper {
-	txt := color.GreenString("[INFO] "+format, a...)
-	fmt.Print(txt)
+	mu.Lock()
+	spin := handler == nil && outputFormat == FormatText && concurrent == 0 && !spinning &&
+		level.Level() <= slog.LevelInfo && terminal(output)
+	if spin {
+		spinning = true
+		color.New(color.FgGreen).Fprintf(output, "[INFO] "+format+"\n", a...)
+	}
+	mu.Unlock()
 
-	var s *spinner.Spinner
-	if isatty.IsTerminal(os.Stdout.Fd()) {
-		fmt.Print("\n")
-		s = spinner.New(spinner.CharSets[38], 100*time.Millisecond) // Build our new spinner
-		s.Start()
+	if !spin {
+		Info(format, a...)
+		return &spinnerWrapper{}
 	}
 
-	return &spinnerWrapper{s}
+	s := spinner.New(spinner.CharSets[38], 100*time.Millisecond, spinner.WithWriter(output)) // Build our new spinner
+	s.Start()
+	return &spinnerWrapper{spinner: s}
+}
+
+type spinnerWrapper struct {
+	spinner *spinner.Spinner
+	once    sync.Once
+}
+
+// Stop erases the spinner. The message is already on its own line.
+func (s *spinnerWrapper) Stop() {
+	if s.spinner == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.spinner.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		spinning = false
+	})
+}
+
+func (s *spinnerWrapper) Finish() {
+	s.Stop()
 }
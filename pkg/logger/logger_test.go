@@ -0,0 +1,211 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func capture(t *testing.T, format string, l slog.Level) *bytes.Buffer {
+	var buffer bytes.Buffer
+	output = &buffer
+	require.NoError(t, SetFormat(format))
+	SetLevel(l)
+	t.Cleanup(func() {
+		output = os.Stdout
+		SetFormat(FormatText)
+		SetLevel(slog.LevelInfo)
+	})
+	return &buffer
+}
+
+func TestJSONFormat(t *testing.T) {
+	buffer := capture(t, FormatJSON, slog.LevelDebug)
+
+	Info("jobs = %d", 2)
+	Event(EventFileSkipped, Fields{"target": "github.com/foo/bar", "file": "a.proto", "reason": "ignore"}, "skipped %s", "a.proto")
+	Event(EventError, Fields{"error": "boom"}, "failed")
+	InfoWithSpinner("Getting %s ", "github.com/foo/bar").Finish()
+	Trace("copied %s", "a.proto")
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+
+	events := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		require.NotEmpty(t, event["time"])
+		delete(event, "time")
+		events = append(events, event)
+	}
+
+	require.Equal(t, []map[string]interface{}{
+		{"level": "info", "message": "jobs = 2"},
+		{"level": "debug", "event": "file_skipped", "message": "skipped a.proto", "target": "github.com/foo/bar", "file": "a.proto", "reason": "ignore"},
+		{"level": "error", "event": "error", "message": "failed", "error": "boom"},
+		{"level": "info", "message": "Getting github.com/foo/bar "},
+	}, events)
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    slog.Level
+		expected string
+	}{
+		{
+			name:     "quiet",
+			level:    slog.LevelWarn,
+			expected: "[WARN] outdated\n",
+		},
+		{
+			name:     "default",
+			level:    slog.LevelInfo,
+			expected: "[INFO] resolving\n[WARN] outdated\n",
+		},
+		{
+			name:     "verbose",
+			level:    slog.LevelDebug,
+			expected: "[INFO] resolving\n[DEBUG] skipped a.proto\n[WARN] outdated\n",
+		},
+		{
+			name:     "very verbose",
+			level:    LevelTrace,
+			expected: "[INFO] resolving\n[DEBUG] skipped a.proto\n[TRACE] copied b.proto\n[WARN] outdated\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := capture(t, FormatText, tt.level)
+
+			Info("resolving")
+			Event(EventFileSkipped, nil, "skipped %s", "a.proto")
+			Trace("copied %s", "b.proto")
+			Warn("outdated")
+
+			require.Equal(t, tt.expected, buffer.String())
+		})
+	}
+}
+
+func TestSetHandler(t *testing.T) {
+	var buffer bytes.Buffer
+	SetHandler(slog.NewTextHandler(&buffer, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	t.Cleanup(func() { SetHandler(nil) })
+
+	Event(EventFilesCopied, Fields{"target": "github.com/foo/bar", "files": 2}, "copied %d files", 2)
+	Trace("copied %s", "a.proto")
+
+	require.Equal(t, "level=INFO msg=\"copied 2 files\" event=files_copied files=2 target=github.com/foo/bar\n", buffer.String())
+}
+
+// reentrantHandler logs through the package while handling a record.
+type reentrantHandler struct {
+	slog.Handler
+}
+
+func (h reentrantHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		Info("handled %s", r.Message)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func TestSetHandlerReentrant(t *testing.T) {
+	var buffer bytes.Buffer
+	SetHandler(reentrantHandler{slog.NewTextHandler(&buffer, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})})
+	t.Cleanup(func() { SetHandler(nil) })
+
+	Warn("outdated")
+
+	require.Equal(t, "level=INFO msg=\"handled outdated\"\nlevel=WARN msg=outdated\n", buffer.String())
+}
+
+func TestEventLevels(t *testing.T) {
+	buffer := capture(t, FormatText, slog.LevelInfo)
+	Event(EventDependencyFinished, Fields{"target": "github.com/foo/bar"}, "resolved %s", "github.com/foo/bar")
+	require.Empty(t, buffer.String())
+
+	// CI consumers of JSON output follow every dependency without -v.
+	buffer = capture(t, FormatJSON, slog.LevelInfo)
+	Event(EventDependencyFinished, Fields{"target": "github.com/foo/bar"}, "resolved %s", "github.com/foo/bar")
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &event))
+	require.Equal(t, "info", event["level"])
+	require.Equal(t, EventDependencyFinished, event["event"])
+}
+
+func TestSetFormat(t *testing.T) {
+	require.Error(t, SetFormat("yaml"))
+	require.False(t, IsJSON())
+}
+
+func TestReported(t *testing.T) {
+	err := errors.New("fetch failed")
+	reported := Reported(err)
+
+	require.True(t, IsReported(reported))
+	require.Equal(t, "fetch failed", reported.Error())
+	require.ErrorIs(t, reported, err)
+
+	// Wrapping adds context the event did not print.
+	require.False(t, IsReported(fmt.Errorf("up: %w", reported)))
+	require.False(t, IsReported(err))
+}
+
+func TestSpinners(t *testing.T) {
+	buffer := capture(t, FormatText, slog.LevelInfo)
+	isTerminal := terminal
+	terminal = func(io.Writer) bool { return true }
+	t.Cleanup(func() {
+		terminal = isTerminal
+	})
+
+	// Only the first spinner is drawn, the second message is printed plain on its own line.
+	first := InfoWithSpinner("Getting %s", "a")
+	require.NotNil(t, first.spinner)
+	second := InfoWithSpinner("Getting %s", "b")
+	require.Nil(t, second.spinner)
+	second.Stop()
+	first.Finish()
+	first.Stop()
+
+	// No spinner while several jobs run.
+	done := Concurrent()
+	third := InfoWithSpinner("Getting %s", "c")
+	require.Nil(t, third.spinner)
+	third.Finish()
+	done()
+
+	fourth := InfoWithSpinner("Getting %s", "d")
+	require.NotNil(t, fourth.spinner)
+	fourth.Finish()
+
+	require.Equal(t, "[INFO] Getting a\n[INFO] Getting b\n[INFO] Getting c\n[INFO] Getting d\n", buffer.String())
+}
@@ -0,0 +1,122 @@
+package protoimport
+
+import (
+	"strings"
+)
+
+// Import is an import statement of a .proto file.
+type Import struct {
+	// Path is the imported file, like "google/protobuf/empty.proto".
+	Path string
+	// Line is the 1-based line the import statement starts on.
+	Line int
+	// Modifier is "public", "weak" or empty.
+	Modifier string
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+// Parse returns the import statements of a .proto file. Comments are skipped, and
+// invalid statements are ignored since protoc reports them anyway.
+func Parse(content []byte) []Import {
+	tokens := tokenize(string(content))
+
+	imports := make([]Import, 0)
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != tokenIdent || t.value != "import" {
+			continue
+		}
+		// "import" only starts a statement at the beginning of the file or after another one.
+		if i > 0 && !(tokens[i-1].kind == tokenSymbol && (tokens[i-1].value == ";" || tokens[i-1].value == "}")) {
+			continue
+		}
+
+		j := i + 1
+		var modifier string
+		if j < len(tokens) && tokens[j].kind == tokenIdent && (tokens[j].value == "public" || tokens[j].value == "weak") {
+			modifier = tokens[j].value
+			j++
+		}
+
+		if j+1 < len(tokens) && tokens[j].kind == tokenString && tokens[j+1].kind == tokenSymbol && tokens[j+1].value == ";" {
+			imports = append(imports, Import{
+				Path:     tokens[j].value,
+				Line:     t.line,
+				Modifier: modifier,
+			})
+			i = j + 1
+		}
+	}
+
+	return imports
+}
+
+func tokenize(src string) []token {
+	tokens := make([]token, 0)
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			} else {
+				end += 2
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += 2 + end
+		case c == '"' || c == '\'':
+			start := line
+			var b strings.Builder
+			i++
+			for i < len(src) && src[i] != c && src[i] != '\n' {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, value: b.String(), line: start})
+		case isIdentChar(c):
+			start := i
+			for i < len(src) && isIdentChar(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: src[start:i], line: line})
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, value: string(c), line: line})
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
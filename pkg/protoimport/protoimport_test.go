@@ -0,0 +1,44 @@
+package protoimport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	content := `// Copyright
+syntax = "proto3";
+
+package example.v1;
+
+import "google/protobuf/empty.proto";
+import public 'example/v1/model.proto';
+import weak "example/v1/legacy.proto";
+// import "commented/out.proto";
+/*
+import "block/commented.proto";
+*/
+import
+  "example/v1/multiline.proto";
+
+option go_package = "example.com/import/v1";
+
+message Foo {
+  string import = 1;
+  string path = 2; // import "trailing.proto";
+}
+`
+
+	require.Equal(t, []Import{
+		{Path: "google/protobuf/empty.proto", Line: 6},
+		{Path: "example/v1/model.proto", Line: 7, Modifier: "public"},
+		{Path: "example/v1/legacy.proto", Line: 8, Modifier: "weak"},
+		{Path: "example/v1/multiline.proto", Line: 13},
+	}, Parse([]byte(content)))
+}
+
+func TestParseWithoutImports(t *testing.T) {
+	require.Empty(t, Parse([]byte(`syntax = "proto3"; message Empty {}`)))
+	require.Empty(t, Parse(nil))
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+)
+
+// archive is a .tar.gz or .zip archive downloaded over HTTP. Extracted archives are cached
+// under .protodep/archives by their sha256, so a pinned archive is only downloaded once.
+type archive struct {
+	protodepDir string
+	dep         config.ProtoDepDependency
+	offline     bool
+
+	// sum is the sha256 of the archive, known after Open.
+	sum string
+}
+
+func NewArchive(protodepDir string, dep config.ProtoDepDependency, opt ...Option) Source {
+	opts := newOptions(opt)
+
+	return &archive{
+		protodepDir: protodepDir,
+		dep:         dep,
+		offline:     opts.offline,
+	}
+}
+
+func (a *archive) Open(ctx context.Context) (*OpenedRepository, error) {
+	pinned := strings.ToLower(a.dep.SHA256)
+
+	if pinned != "" {
+		if stat, err := os.Stat(a.extractDir(pinned)); err == nil && stat.IsDir() {
+			logger.Info("Using cached %s", a.dep.URL)
+			return a.opened(pinned), nil
+		}
+	}
+
+	if a.offline {
+		return nil, fmt.Errorf("%s: %w", a.dep.URL, ErrNotCached)
+	}
+
+	spinner := logger.InfoWithSpinner("Getting %s ", a.dep.URL)
+	content, err := download(ctx, a.dep.URL)
+	if err != nil {
+		spinner.Stop()
+		return nil, err
+	}
+	spinner.Finish()
+
+	digest := sha256.Sum256(content)
+	sum := hex.EncodeToString(digest[:])
+
+	if pinned == "" {
+		logger.Warn("%s is not pinned, add sha256 = \"%s\" to protodep.toml", a.dep.URL, sum)
+	} else if pinned != sum {
+		return nil, fmt.Errorf("sha256 of %s is %s, but %s is pinned", a.dep.URL, sum, pinned)
+	}
+
+	if err := a.extract(content, sum); err != nil {
+		return nil, err
+	}
+
+	return a.opened(sum), nil
+}
+
+// ProtoRootDir returns the directory of the extracted archive. It is only valid after Open.
+func (a *archive) ProtoRootDir() string {
+	return filepath.Join(a.extractDir(a.sum), filepath.FromSlash(a.dep.Subdir))
+}
+
+func (a *archive) opened(sum string) *OpenedRepository {
+	a.sum = sum
+
+	dep := a.dep
+	dep.SHA256 = sum
+	return &OpenedRepository{
+		Dep: dep,
+	}
+}
+
+func (a *archive) extractDir(sum string) string {
+	return filepath.Join(a.protodepDir, "archives", sum)
+}
+
+// extract unpacks content into a temporary directory first, so an interrupted extraction
+// never looks like a cached archive. Dependencies sharing an archive may extract it at the
+// same time, so an archive already in the cache is kept rather than replaced while it may
+// be read. Its content is the same, since the directory is named after the sha256.
+func (a *archive) extract(content []byte, sum string) error {
+	dest := a.extractDir(sum)
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return fmt.Errorf("create archive cache: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), sum+".tmp")
+	if err != nil {
+		return fmt.Errorf("create archive cache: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	switch {
+	case bytes.HasPrefix(content, []byte{0x1f, 0x8b}):
+		err = extractTarGz(content, tmp)
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		err = extractZip(content, tmp)
+	default:
+		err = fmt.Errorf("unknown archive format (.tar.gz or .zip only)")
+	}
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", a.dep.URL, err)
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		if stat, statErr := os.Stat(dest); statErr == nil && stat.IsDir() {
+			return nil
+		}
+		return fmt.Errorf("extract %s: %w", a.dep.URL, err)
+	}
+	return nil
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", url, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %w", url, &StatusError{StatusCode: resp.StatusCode, Message: resp.Status})
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", url, err)
+	}
+	return content, nil
+}
+
+func extractTarGz(content []byte, dest string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := writeArchiveEntry(dest, header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(content []byte, dest string) error {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveEntry(dest, file.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchiveEntry writes an archive entry below dest, refusing names that escape it.
+func writeArchiveEntry(dest string, name string, r io.Reader) error {
+	cleaned := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("invalid entry %s", name)
+	}
+
+	target := filepath.Join(dest, filepath.FromSlash(cleaned))
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
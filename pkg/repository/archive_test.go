@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func sha256Of(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func serveArchive(t *testing.T, content []byte) (string, *int) {
+	t.Helper()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/protos.tar.gz", &requests
+}
+
+func TestArchiveOpen(t *testing.T) {
+	files := map[string]string{
+		"protos-1.0/proto/foo/foo.proto": "syntax = \"proto3\";",
+		"protos-1.0/README.md":           "readme",
+	}
+
+	for name, content := range map[string][]byte{
+		"tar.gz": tarGz(t, files),
+		"zip":    zipArchive(t, files),
+	} {
+		t.Run(name, func(t *testing.T) {
+			protodepDir := t.TempDir()
+			url, requests := serveArchive(t, content)
+
+			dep := config.ProtoDepDependency{
+				Target: "github.com/example/protos",
+				Source: config.SourceArchive,
+				URL:    url,
+				SHA256: sha256Of(content),
+				Subdir: "protos-1.0/proto",
+			}
+
+			source := NewArchive(protodepDir, dep)
+			opened, err := source.Open(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, sha256Of(content), opened.Dep.SHA256)
+
+			got, err := os.ReadFile(filepath.Join(source.ProtoRootDir(), "foo", "foo.proto"))
+			require.NoError(t, err)
+			require.Equal(t, "syntax = \"proto3\";", string(got))
+
+			// The pinned archive is extracted in the cache, so it is not downloaded again,
+			// even offline.
+			source = NewArchive(protodepDir, dep, WithOffline())
+			_, err = source.Open(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, *requests)
+		})
+	}
+}
+
+func TestArchiveOpenUnpinned(t *testing.T) {
+	content := tarGz(t, map[string]string{"foo.proto": "syntax = \"proto3\";"})
+	url, _ := serveArchive(t, content)
+
+	opened, err := NewArchive(t.TempDir(), config.ProtoDepDependency{Target: "example", URL: url}).Open(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, sha256Of(content), opened.Dep.SHA256)
+}
+
+func TestArchiveOpenShared(t *testing.T) {
+	content := tarGz(t, map[string]string{"foo.proto": "syntax = \"proto3\";"})
+	url, _ := serveArchive(t, content)
+	protodepDir := t.TempDir()
+
+	// Dependencies sharing an archive open it at the same time.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			source := NewArchive(protodepDir, config.ProtoDepDependency{Target: fmt.Sprintf("example%d", i), URL: url})
+			if _, err := source.Open(context.Background()); err != nil {
+				errs[i] = err
+				return
+			}
+			_, errs[i] = os.ReadFile(filepath.Join(source.ProtoRootDir(), "foo.proto"))
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(protodepDir, "archives"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestArchiveOpenChecksumMismatch(t *testing.T) {
+	content := tarGz(t, map[string]string{"foo.proto": "syntax = \"proto3\";"})
+	url, _ := serveArchive(t, content)
+
+	dep := config.ProtoDepDependency{
+		Target: "example",
+		URL:    url,
+		SHA256: sha256Of([]byte("something else")),
+	}
+	_, err := NewArchive(t.TempDir(), dep).Open(context.Background())
+	require.ErrorContains(t, err, "sha256 of "+url+" is "+sha256Of(content))
+}
+
+func TestArchiveOpenOffline(t *testing.T) {
+	dep := config.ProtoDepDependency{Target: "example", URL: "http://127.0.0.1:0/protos.tar.gz"}
+	_, err := NewArchive(t.TempDir(), dep, WithOffline()).Open(context.Background())
+	require.True(t, errors.Is(err, ErrNotCached))
+}
+
+func TestArchiveOpenRejectsEscapingEntries(t *testing.T) {
+	for _, name := range []string{"../evil.proto", "/etc/evil.proto", "foo/../../evil.proto"} {
+		content := tarGz(t, map[string]string{name: "evil"})
+		url, _ := serveArchive(t, content)
+
+		protodepDir := t.TempDir()
+		_, err := NewArchive(protodepDir, config.ProtoDepDependency{Target: "example", URL: url}).Open(context.Background())
+		require.ErrorContains(t, err, "invalid entry", name)
+
+		_, err = os.Stat(filepath.Join(protodepDir, "evil.proto"))
+		require.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestLocalOpen(t *testing.T) {
+	baseDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(baseDir, "shared", "proto"), 0777))
+
+	source := NewLocal(config.ProtoDepDependency{Target: "shared/proto", Source: config.SourceLocal}, WithBaseDir(baseDir))
+	_, err := source.Open(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(baseDir, "shared", "proto"), source.ProtoRootDir())
+
+	_, err = NewLocal(config.ProtoDepDependency{Target: "missing"}, WithBaseDir(baseDir)).Open(context.Background())
+	require.Error(t, err)
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+)
+
+const downloadProcedure = "/buf.registry.module.v1.DownloadService/Download"
+
+// bsr is a module of a Buf Schema Registry, downloaded with the Connect JSON protocol of
+// the registry API. Downloaded commits are cached under .protodep/bsr.
+type bsr struct {
+	protodepDir string
+	dep         config.ProtoDepDependency
+	offline     bool
+
+	host   string
+	owner  string
+	module string
+
+	// commit is the downloaded module commit, known after Open.
+	commit string
+}
+
+func NewBSR(protodepDir string, dep config.ProtoDepDependency, opt ...Option) (Source, error) {
+	opts := newOptions(opt)
+
+	tokens := strings.Split(dep.Target, "/")
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("%s: bsr target must be like buf.build/<owner>/<module>", dep.Target)
+	}
+
+	return &bsr{
+		protodepDir: protodepDir,
+		dep:         dep,
+		offline:     opts.offline,
+		host:        tokens[0],
+		owner:       tokens[1],
+		module:      tokens[2],
+	}, nil
+}
+
+type bsrDownloadRequest struct {
+	Values []bsrDownloadValue `json:"values"`
+}
+
+type bsrDownloadValue struct {
+	ResourceRef bsrResourceRef `json:"resourceRef"`
+}
+
+type bsrResourceRef struct {
+	Name bsrResourceName `json:"name"`
+}
+
+type bsrResourceName struct {
+	Owner  string `json:"owner"`
+	Module string `json:"module"`
+	Ref    string `json:"ref,omitempty"`
+}
+
+type bsrDownloadResponse struct {
+	Contents []bsrContent `json:"contents"`
+}
+
+type bsrContent struct {
+	Commit struct {
+		ID     string `json:"id"`
+		Digest struct {
+			Type  string `json:"type"`
+			Value []byte `json:"value"`
+		} `json:"digest"`
+	} `json:"commit"`
+	Files []struct {
+		Path    string `json:"path"`
+		Content []byte `json:"content"`
+	} `json:"files"`
+}
+
+type bsrError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (b *bsr) Open(ctx context.Context) (*OpenedRepository, error) {
+	// A commit never changes, so a cached one is used without asking the registry.
+	if b.dep.Revision != "" {
+		if stat, err := os.Stat(b.commitDir(b.dep.Revision)); err == nil && stat.IsDir() {
+			logger.Info("Using cached %s:%s", b.dep.Target, b.dep.Revision)
+			digest, err := os.ReadFile(b.commitDir(b.dep.Revision) + ".digest")
+			if err != nil {
+				return nil, fmt.Errorf("read cached digest of %s: %w", b.dep.Target, err)
+			}
+			if err := b.checkDigest(b.dep.Revision, string(digest)); err != nil {
+				return nil, err
+			}
+			return b.opened(b.dep.Revision, string(digest)), nil
+		}
+	}
+
+	if b.offline {
+		return nil, fmt.Errorf("%s at %s: %w", b.dep.Target, b.ref(), ErrNotCached)
+	}
+
+	spinner := logger.InfoWithSpinner("Getting %s ", b.dep.Target)
+	content, err := b.download(ctx)
+	if err != nil {
+		spinner.Stop()
+		return nil, err
+	}
+	spinner.Finish()
+
+	commit := content.Commit.ID
+	if commit == "" {
+		return nil, fmt.Errorf("download %s: registry returned no commit", b.dep.Target)
+	}
+	if b.ref() != "" && b.ref() != commit {
+		logger.Info("%s label %s resolved to commit %s", b.dep.Target, b.ref(), commit)
+	}
+
+	var digest string
+	if content.Commit.Digest.Type != "" {
+		digest = strings.ToLower(strings.TrimPrefix(content.Commit.Digest.Type, "DIGEST_TYPE_")) + ":" + hex.EncodeToString(content.Commit.Digest.Value)
+	}
+
+	if err := b.checkDigest(commit, digest); err != nil {
+		return nil, err
+	}
+	if err := b.store(content, commit, digest); err != nil {
+		return nil, err
+	}
+
+	return b.opened(commit, digest), nil
+}
+
+// ProtoRootDir returns the directory of the downloaded module. It is only valid after Open.
+func (b *bsr) ProtoRootDir() string {
+	return filepath.Join(b.commitDir(b.commit), filepath.FromSlash(b.dep.Subdir))
+}
+
+func (b *bsr) opened(commit string, digest string) *OpenedRepository {
+	b.commit = commit
+
+	dep := b.dep
+	dep.Digest = digest
+	return &OpenedRepository{
+		Dep:  dep,
+		Hash: commit,
+	}
+}
+
+// checkDigest fails when the dependency is locked to commit with another digest. Digests of
+// another type, like the shake256 digests of buf.lock v1, cannot be compared.
+func (b *bsr) checkDigest(commit string, digest string) error {
+	locked := b.dep.Digest
+	if locked == "" || digest == "" || commit != b.dep.Revision || digestType(locked) != digestType(digest) {
+		return nil
+	}
+	if locked != digest {
+		return fmt.Errorf("%s at %s: digest %s does not match %s in protodep.lock", b.dep.Target, commit, digest, locked)
+	}
+	return nil
+}
+
+// digestType returns the type of a digest like b5:0a1b, b5.
+func digestType(digest string) string {
+	typ, _, _ := strings.Cut(digest, ":")
+	return typ
+}
+
+// ref is the commit or label to download, the default label of the module when empty.
+func (b *bsr) ref() string {
+	if b.dep.Revision != "" {
+		return b.dep.Revision
+	}
+	return b.dep.Branch
+}
+
+func (b *bsr) commitDir(commit string) string {
+	return filepath.Join(b.protodepDir, "bsr", b.host, b.owner, b.module, commit)
+}
+
+func (b *bsr) registryURL() string {
+	if b.dep.URL != "" {
+		return strings.TrimSuffix(b.dep.URL, "/")
+	}
+	return "https://" + b.host
+}
+
+func (b *bsr) download(ctx context.Context) (*bsrContent, error) {
+	body, err := json.Marshal(bsrDownloadRequest{
+		Values: []bsrDownloadValue{
+			{ResourceRef: bsrResourceRef{Name: bsrResourceName{Owner: b.owner, Module: b.module, Ref: b.ref()}}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.registryURL()+downloadProcedure, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", b.dep.Target, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	if token := bufToken(b.host); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", b.dep.Target, err)
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", b.dep.Target, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Message: resp.Status}
+		var e bsrError
+		if err := json.Unmarshal(payload, &e); err == nil && e.Message != "" {
+			statusErr.Message = e.Code + ": " + e.Message
+		}
+		return nil, fmt.Errorf("download %s: %w", b.dep.Target, statusErr)
+	}
+
+	var res bsrDownloadResponse
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return nil, fmt.Errorf("download %s: decode response: %w", b.dep.Target, err)
+	}
+	if len(res.Contents) == 0 {
+		return nil, fmt.Errorf("download %s: registry returned no content", b.dep.Target)
+	}
+
+	return &res.Contents[0], nil
+}
+
+// store writes the module files into a temporary directory first, so an interrupted
+// download never looks like a cached commit.
+func (b *bsr) store(content *bsrContent, commit string, digest string) error {
+	dest := b.commitDir(commit)
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return fmt.Errorf("create bsr cache: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), commit+".tmp")
+	if err != nil {
+		return fmt.Errorf("create bsr cache: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, file := range content.Files {
+		if err := writeArchiveEntry(tmp, file.Path, bytes.NewReader(file.Content)); err != nil {
+			return fmt.Errorf("store %s: %w", b.dep.Target, err)
+		}
+	}
+
+	if err := os.WriteFile(dest+".digest", []byte(digest), 0644); err != nil {
+		return fmt.Errorf("store %s: %w", b.dep.Target, err)
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// bufToken returns the registry token from BUF_TOKEN, which is either a single token or
+// a comma separated list of token@host pairs, like buf accepts it.
+func bufToken(host string) string {
+	value := os.Getenv("BUF_TOKEN")
+	if !strings.Contains(value, "@") {
+		return value
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		token, tokenHost, found := strings.Cut(strings.TrimSpace(pair), "@")
+		if found && tokenHost == host {
+			return token
+		}
+	}
+	return ""
+}
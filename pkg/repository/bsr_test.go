@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+const testCommit = "7a6bc1e3707148a4b4d1f2e6d7e9c0a1"
+
+// newTestRegistry serves the download API of a registry with a single module,
+// buf.build/acme/weather, whose "main" label points to testCommit.
+func newTestRegistry(t *testing.T) (string, *int) {
+	t.Helper()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, downloadProcedure, r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req bsrDownloadRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Values, 1)
+		name := req.Values[0].ResourceRef.Name
+
+		w.Header().Set("Content-Type", "application/json")
+		if name.Owner != "acme" || name.Module != "weather" || (name.Ref != "main" && name.Ref != testCommit) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"not_found","message":"module not found"}`))
+			return
+		}
+
+		w.Write([]byte(`{"contents":[{
+			"commit":{"id":"` + testCommit + `","digest":{"type":"DIGEST_TYPE_B5","value":"AQID"}},
+			"files":[
+				{"path":"acme/weather/v1/weather.proto","content":"c3ludGF4ID0gInByb3RvMyI7"},
+				{"path":"buf.yaml","content":"dmVyc2lvbjogdjI="}
+			]
+		}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &requests
+}
+
+func TestBSROpen(t *testing.T) {
+	url, requests := newTestRegistry(t)
+	protodepDir := t.TempDir()
+
+	dep := config.ProtoDepDependency{
+		Target: "buf.build/acme/weather",
+		Source: config.SourceBSR,
+		Branch: "main",
+		URL:    url,
+	}
+
+	source, err := NewBSR(protodepDir, dep)
+	require.NoError(t, err)
+	opened, err := source.Open(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, testCommit, opened.Hash)
+	require.Equal(t, "b5:010203", opened.Dep.Digest)
+
+	got, err := os.ReadFile(filepath.Join(source.ProtoRootDir(), "acme", "weather", "v1", "weather.proto"))
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3";`, string(got))
+
+	// The locked commit is cached, so it is not downloaded again, even offline.
+	dep.Revision = testCommit
+	source, err = NewBSR(protodepDir, dep, WithOffline())
+	require.NoError(t, err)
+	opened, err = source.Open(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "b5:010203", opened.Dep.Digest)
+	require.Equal(t, 1, *requests)
+}
+
+func TestBSROpenDigestMismatch(t *testing.T) {
+	url, _ := newTestRegistry(t)
+	protodepDir := t.TempDir()
+
+	dep := config.ProtoDepDependency{
+		Target:   "buf.build/acme/weather",
+		Source:   config.SourceBSR,
+		Revision: testCommit,
+		Digest:   "b5:ffffff",
+		URL:      url,
+	}
+
+	// The registry serves another digest for the locked commit, which is not cached.
+	source, err := NewBSR(protodepDir, dep)
+	require.NoError(t, err)
+	_, err = source.Open(context.Background())
+	require.ErrorContains(t, err, "digest b5:010203 does not match b5:ffffff in protodep.lock")
+	require.NoDirExists(t, filepath.Join(protodepDir, "bsr", "buf.build", "acme", "weather", testCommit))
+
+	// A digest of another type cannot be compared.
+	dep.Digest = "shake256:ffffff"
+	source, err = NewBSR(protodepDir, dep)
+	require.NoError(t, err)
+	opened, err := source.Open(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "b5:010203", opened.Dep.Digest)
+
+	// The digest of a cached commit is checked as well.
+	dep.Digest = "b5:ffffff"
+	source, err = NewBSR(protodepDir, dep, WithOffline())
+	require.NoError(t, err)
+	_, err = source.Open(context.Background())
+	require.ErrorContains(t, err, "digest b5:010203 does not match b5:ffffff in protodep.lock")
+}
+
+func TestBSROpenNotFound(t *testing.T) {
+	url, _ := newTestRegistry(t)
+
+	source, err := NewBSR(t.TempDir(), config.ProtoDepDependency{Target: "buf.build/acme/unknown", URL: url})
+	require.NoError(t, err)
+	_, err = source.Open(context.Background())
+	require.ErrorContains(t, err, "not_found: module not found")
+}
+
+func TestBSROpenOffline(t *testing.T) {
+	source, err := NewBSR(t.TempDir(), config.ProtoDepDependency{Target: "buf.build/acme/weather", Branch: "main"}, WithOffline())
+	require.NoError(t, err)
+	_, err = source.Open(context.Background())
+	require.True(t, errors.Is(err, ErrNotCached))
+}
+
+func TestBufToken(t *testing.T) {
+	t.Setenv("BUF_TOKEN", "secret")
+	require.Equal(t, "secret", bufToken("buf.build"))
+
+	t.Setenv("BUF_TOKEN", "one@buf.build,two@bsr.example.com")
+	require.Equal(t, "two", bufToken("bsr.example.com"))
+	require.Equal(t, "", bufToken("other.example.com"))
+}
@@ -1,44 +1,58 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 
 	"github.com/stormcat24/protodep/pkg/auth"
 	"github.com/stormcat24/protodep/pkg/config"
 	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/semver"
 )
 
 type Git interface {
-	Open() (*OpenedRepository, error)
-	ProtoRootDir() string
+	Source
+	Upstream(ctx context.Context) (*Upstream, error)
+	DefaultBranch(ctx context.Context) (string, error)
 }
 
 type github struct {
 	protodepDir  string
 	dep          config.ProtoDepDependency
 	authProvider auth.AuthProvider
+	offline      bool
 }
 
-func NewGit(protodepDir string, dep config.ProtoDepDependency, authProvider auth.AuthProvider) Git {
+func NewGit(protodepDir string, dep config.ProtoDepDependency, authProvider auth.AuthProvider, opt ...Option) Git {
+	opts := newOptions(opt)
+
 	return &github{
 		protodepDir:  protodepDir,
 		dep:          dep,
 		authProvider: authProvider,
+		offline:      opts.offline,
 	}
 }
 
 type OpenedRepository struct {
+	// Repository is nil for sources other than git.
 	Repository *git.Repository
 	Dep        config.ProtoDepDependency
 	Hash       string
+	// Tag is the tag that was checked out, empty when checked out by branch or hash.
+	Tag string
 }
 
-func (r *github) Open() (*OpenedRepository, error) {
+func (r *github) Open(ctx context.Context) (*OpenedRepository, error) {
 
 	branch := "master"
 	if r.dep.Branch != "" {
@@ -47,52 +61,34 @@ func (r *github) Open() (*OpenedRepository, error) {
 
 	revision := r.dep.Revision
 
-	reponame := r.dep.Repository()
-	repopath := filepath.Join(r.protodepDir, reponame)
-
-	auth, err := r.authProvider.AuthMethod()
-	if err != nil {
-		return nil, err
-	}
-
 	var rep *git.Repository
-
-	if stat, err := os.Stat(repopath); err == nil && stat.IsDir() {
-		spinner := logger.InfoWithSpinner("Getting %s ", reponame)
-
-		rep, err = git.PlainOpen(repopath)
+	var err error
+	if r.offline {
+		rep, err = r.openCache()
 		if err != nil {
-			return nil, fmt.Errorf("open repository: %w", err)
-		}
-		spinner.Stop()
-
-		fetchOpts := &git.FetchOptions{
-			Auth: auth,
+			return nil, err
 		}
-
-		// TODO: Validate remote setting.
-		// TODO: If .protodep cache remains with SSH, change remote target to HTTPS.
-
-		if err := rep.Fetch(fetchOpts); err != nil {
-			if err != git.NoErrAlreadyUpToDate {
-				return nil, fmt.Errorf("fetch repository: %w", err)
+		if revision == "" && r.dep.Version != "" {
+			tags, err := r.tagNames(rep)
+			if err != nil {
+				return nil, err
+			}
+			// Shallow fetches only bring the tags of the fetched commits.
+			logger.Warn("resolving version %s of %s offline among the %d tags in the cache, newer tags may be missing", r.dep.Version, r.dep.Repository(), len(tags))
+			revision, err = r.resolveVersion(tags)
+			if err != nil {
+				return nil, err
 			}
 		}
-		spinner.Finish()
-
 	} else {
-		spinner := logger.InfoWithSpinner("Getting %s ", reponame)
-		// IDEA: Is it better to register both ssh and HTTP?
-		rep, err = git.PlainClone(repopath, false, &git.CloneOptions{
-			Auth: auth,
-			URL:  r.authProvider.GetRepositoryURL(reponame),
-		})
+		rep, revision, err = r.fetchRevision(ctx, branch, revision)
 		if err != nil {
-			return nil, fmt.Errorf("clone repository: %w", err)
+			return nil, err
 		}
-		spinner.Finish()
 	}
 
+	var resolvedTag string
+
 	wt, err := rep.Worktree()
 	if err != nil {
 		return nil, fmt.Errorf("get worktree: %w", err)
@@ -100,6 +96,9 @@ func (r *github) Open() (*OpenedRepository, error) {
 
 	if revision == "" {
 		target, err := r.resolveReference(rep, branch)
+		if r.offline && err == plumbing.ErrReferenceNotFound {
+			return nil, fmt.Errorf("%s branch %s: %w", r.dep.Repository(), branch, ErrNotCached)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("change branch to %s: %w", branch, err)
 		}
@@ -122,12 +121,18 @@ func (r *github) Open() (*OpenedRepository, error) {
 		} else {
 			if err != nil {
 				// Tag not found, revision must be a hash
-				logger.Info("%s is not a tag, checking out by hash", revision)
+				logger.Debug("%s is not a tag, checking out by hash", revision)
 				hash := plumbing.NewHash(revision)
+				if r.offline {
+					if _, err := rep.CommitObject(hash); err != nil {
+						return nil, fmt.Errorf("%s at %s: %w", r.dep.Repository(), revision, ErrNotCached)
+					}
+				}
 				opts = git.CheckoutOptions{Hash: hash}
 			} else {
-				logger.Info("%s is a tag, checking out by tag", revision)
+				logger.Debug("%s is a tag, checking out by tag", revision)
 				opts = git.CheckoutOptions{Branch: tag}
+				resolvedTag = revision
 			}
 		}
 
@@ -150,13 +155,531 @@ func (r *github) Open() (*OpenedRepository, error) {
 		Repository: rep,
 		Dep:        r.dep,
 		Hash:       current.Hash.String(),
+		Tag:        resolvedTag,
 	}, nil
 }
 
+// Upstream describes the newest revisions available in the remote repository.
+type Upstream struct {
+	Repository *git.Repository
+	// Branch is the tracked branch, "master" or "main" when the dependency has none.
+	Branch string
+	// BranchHead is the commit hash at the head of Branch.
+	BranchHead string
+	// LatestTag is the newest semver tag, or the highest one allowed by the version of the
+	// dependency. It is empty when there is none.
+	LatestTag string
+	// LatestTagHash is the commit hash LatestTag points to.
+	LatestTagHash string
+}
+
+// Upstream reports the head of the configured branch and the newest semver tag, or the
+// highest tag allowed by the version of the dependency, without touching the worktree. The remote is listed and only these two commits are fetched, so
+// the cache does not get the history between them.
+func (r *github) Upstream(ctx context.Context) (*Upstream, error) {
+	branch := "master"
+	if r.dep.Branch != "" {
+		branch = r.dep.Branch
+	}
+
+	var rep *git.Repository
+	var tags []string
+	if r.offline {
+		cache, err := r.openCache()
+		if err != nil {
+			return nil, err
+		}
+		rep = cache
+		if tags, err = r.tagNames(rep); err != nil {
+			return nil, err
+		}
+	} else {
+		err := r.withCache(ctx, func(cache *git.Repository, auth transport.AuthMethod) error {
+			rep = cache
+			refs, err := r.listRemote(ctx, rep, auth)
+			if err != nil {
+				return err
+			}
+			tags = remoteTagNames(refs)
+			latest, err := r.latestTag(tags)
+			if err != nil {
+				return err
+			}
+
+			specs := make([]gitconfig.RefSpec, 0, 2)
+			if name := remoteBranch(refs, branch); name != "" {
+				specs = append(specs, branchRefSpec(name))
+			}
+			if latest != "" {
+				tag := plumbing.NewTagReferenceName(latest)
+				specs = append(specs, gitconfig.RefSpec(fmt.Sprintf("+%s:%s", tag, tag)))
+			}
+			if len(specs) == 0 {
+				return nil
+			}
+			return r.fetchRefs(ctx, rep, auth, fetchDepth(rep), git.NoTags, specs...)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	head, err := r.resolveReference(rep, branch)
+	if err != nil {
+		return nil, fmt.Errorf("resolve branch %s: %w", branch, err)
+	}
+	if branch == "master" && head.Name().Short() == "origin/main" {
+		branch = "main"
+	}
+
+	upstream := &Upstream{
+		Repository: rep,
+		Branch:     branch,
+		BranchHead: head.Hash().String(),
+	}
+
+	latest, err := r.latestTag(tags)
+	if err != nil {
+		return nil, err
+	}
+	if latest != "" {
+		hash, err := r.tagCommit(rep, latest)
+		if err != nil {
+			return nil, err
+		}
+		upstream.LatestTag = latest
+		upstream.LatestTagHash = hash.String()
+	}
+
+	return upstream, nil
+}
+
+// DefaultBranch asks the remote for the branch its HEAD points to, without cloning.
+func (r *github) DefaultBranch(ctx context.Context) (string, error) {
+	if r.offline {
+		return "", fmt.Errorf("%s default branch: %w", r.dep.Repository(), ErrNotCached)
+	}
+
+	auth, err := r.authProvider.AuthMethod(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{r.authProvider.GetRepositoryURL(r.dep.Repository())},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("list references of %s: %w", r.dep.Repository(), err)
+	}
+
+	var head *plumbing.Reference
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+	}
+	if head == nil {
+		return "", fmt.Errorf("%s has no HEAD", r.dep.Repository())
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short(), nil
+	}
+
+	// Remotes that do not advertise the symbolic HEAD: pick a branch at the same commit,
+	// preferring the usual default names.
+	candidates := make([]string, 0)
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+			candidates = append(candidates, ref.Name().Short())
+		}
+	}
+	for _, name := range []string{"main", "master"} {
+		for _, candidate := range candidates {
+			if candidate == name {
+				return name, nil
+			}
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("cannot find the default branch of %s", r.dep.Repository())
+}
+
 func (r *github) ProtoRootDir() string {
 	return filepath.Join(r.protodepDir, r.dep.Target)
 }
 
+// openCache opens the clone in the .protodep cache for offline mode.
+func (r *github) openCache() (*git.Repository, error) {
+	reponame := r.dep.Repository()
+	rep, err := git.PlainOpen(filepath.Join(r.protodepDir, reponame))
+	if err == git.ErrRepositoryNotExists {
+		return nil, fmt.Errorf("%s: %w", reponame, ErrNotCached)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open repository: %w", err)
+	}
+	logger.Info("Using cached %s", reponame)
+	return rep, nil
+}
+
+// fetchRevision gets revision, or the head of branch when revision is empty, into the
+// .protodep cache. New clones only get that commit, and more history is fetched only when
+// a revision hash cannot be fetched by itself. It returns the revision to check out, which
+// is the matching tag when the dependency has a version constraint.
+func (r *github) fetchRevision(ctx context.Context, branch string, revision string) (*git.Repository, string, error) {
+	var rep *git.Repository
+	err := r.withCache(ctx, func(cache *git.Repository, auth transport.AuthMethod) error {
+		rep = cache
+
+		refs, err := r.listRemote(ctx, rep, auth)
+		if err != nil {
+			return err
+		}
+		depth := fetchDepth(rep)
+
+		if revision == "" && r.dep.Version != "" {
+			revision, err = r.resolveVersion(remoteTagNames(refs))
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case revision == "":
+			name := remoteBranch(refs, branch)
+			if name == "" {
+				return fmt.Errorf("change branch to %s: %w", branch, plumbing.ErrReferenceNotFound)
+			}
+			return r.fetchRefs(ctx, rep, auth, depth, git.NoTags, branchRefSpec(name))
+		case hasReference(refs, plumbing.NewTagReferenceName(revision)):
+			tag := plumbing.NewTagReferenceName(revision)
+			return r.fetchRefs(ctx, rep, auth, depth, git.NoTags, gitconfig.RefSpec(fmt.Sprintf("+%s:%s", tag, tag)))
+		default:
+			return r.fetchHash(ctx, rep, auth, depth, plumbing.NewHash(revision), remoteBranch(refs, branch))
+		}
+	})
+	return rep, revision, err
+}
+
+// listRemote lists the references of the remote of rep, like git ls-remote.
+func (r *github) listRemote(ctx context.Context, rep *git.Repository, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
+	remote, err := rep.Remote("origin")
+	if err != nil {
+		return nil, fmt.Errorf("get remote: %w", err)
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("list references of %s: %w", r.dep.Repository(), err)
+	}
+	return refs, nil
+}
+
+// fetchDepth returns the depth to fetch into rep: 1 commit, or 0 for clones made by older
+// versions, which have the whole history and keep it complete.
+func fetchDepth(rep *git.Repository) int {
+	if !isShallow(rep) && !isEmpty(rep) {
+		return 0
+	}
+	return 1
+}
+
+// fetchHash gets the commit hash. It first asks for the commit alone, which servers may
+// refuse, then for deeper history of branch, and finally for everything.
+func (r *github) fetchHash(ctx context.Context, rep *git.Repository, auth transport.AuthMethod, depth int, hash plumbing.Hash, branch string) error {
+	if hasCommit(rep, hash) {
+		return nil
+	}
+
+	if depth > 0 {
+		spec := gitconfig.RefSpec(fmt.Sprintf("%s:refs/protodep/%s", hash, hash))
+		err := r.fetchRefs(ctx, rep, auth, 1, git.NoTags, spec)
+		if err == nil && hasCommit(rep, hash) {
+			return nil
+		}
+		if ctx.Err() != nil || IsTransient(err) {
+			return err
+		}
+		logger.Debug("%s cannot be fetched alone from %s, fetching more history: %v", hash, r.dep.Repository(), err)
+
+		if branch != "" {
+			for _, steps := range deepenSteps {
+				if err := r.fetchRefs(ctx, rep, auth, steps, git.NoTags, branchRefSpec(branch)); err != nil {
+					return err
+				}
+				if hasCommit(rep, hash) {
+					return nil
+				}
+				logger.Debug("%s is not in the last %d commits of %s", hash, steps, branch)
+			}
+		}
+	}
+
+	if err := r.fetchRefs(ctx, rep, auth, fullDepth, git.AllTags, allBranches); err != nil {
+		return err
+	}
+	if !hasCommit(rep, hash) {
+		return fmt.Errorf("%s has no commit %s", r.dep.Repository(), hash)
+	}
+	return nil
+}
+
+// withCache opens the clone in the .protodep cache, or creates it, and calls f to fetch
+// into it. A clone created here is removed when f fails or is canceled, so that it is
+// not taken for a cached repository.
+func (r *github) withCache(ctx context.Context, f func(rep *git.Repository, auth transport.AuthMethod) error) error {
+	reponame := r.dep.Repository()
+	repopath := filepath.Join(r.protodepDir, reponame)
+
+	auth, err := r.authProvider.AuthMethod(ctx)
+	if err != nil {
+		return err
+	}
+
+	spinner := logger.InfoWithSpinner("Getting %s ", reponame)
+
+	created := false
+	var rep *git.Repository
+	if stat, err := os.Stat(repopath); err == nil && stat.IsDir() {
+		rep, err = git.PlainOpen(repopath)
+		if err != nil {
+			spinner.Stop()
+			return fmt.Errorf("open repository: %w", err)
+		}
+		// TODO: Validate remote setting.
+		// TODO: If .protodep cache remains with SSH, change remote target to HTTPS.
+	} else {
+		created = true
+		rep, err = git.PlainInit(repopath, false)
+		if err == nil {
+			// IDEA: Is it better to register both ssh and HTTP?
+			_, err = rep.CreateRemote(&gitconfig.RemoteConfig{
+				Name:  "origin",
+				URLs:  []string{r.authProvider.GetRepositoryURL(reponame)},
+				Fetch: []gitconfig.RefSpec{allBranches},
+			})
+		}
+		if err != nil {
+			spinner.Stop()
+			r.removeClone(repopath)
+			return fmt.Errorf("clone repository: %w", err)
+		}
+	}
+
+	if err := f(rep, auth); err != nil {
+		spinner.Stop()
+		if created {
+			r.removeClone(repopath)
+			return fmt.Errorf("clone repository: %w", err)
+		}
+		return fmt.Errorf("fetch repository: %w", err)
+	}
+	spinner.Finish()
+
+	return nil
+}
+
+func (r *github) removeClone(repopath string) {
+	if err := os.RemoveAll(repopath); err != nil {
+		logger.Warn("remove partial clone %s: %v", repopath, err)
+	}
+}
+
+const (
+	// fullDepth asks for the whole history, like git fetch --unshallow.
+	fullDepth = 1<<31 - 1
+
+	allBranches = gitconfig.RefSpec("+refs/heads/*:refs/remotes/origin/*")
+)
+
+// deepenSteps are the depths of the branch fetched to find a revision hash that cannot be
+// fetched alone, before fetching everything.
+var deepenSteps = []int{50, 500}
+
+// fetchRefs fetches specs with depth commits of history, 0 for an incremental fetch of a
+// clone with the whole history.
+func (r *github) fetchRefs(ctx context.Context, rep *git.Repository, auth transport.AuthMethod, depth int, tags git.TagMode, specs ...gitconfig.RefSpec) error {
+	shallow := isShallow(rep)
+	if depth == fullDepth && !shallow {
+		depth = 0
+	}
+	if depth > 0 {
+		logger.Debug("fetching %s of %s with depth %d", specs, r.dep.Repository(), depth)
+	}
+
+	err := rep.FetchContext(ctx, &git.FetchOptions{
+		Auth:     auth,
+		RefSpecs: specs,
+		Depth:    depth,
+		Tags:     tags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	if shallow && depth != 1 {
+		return pruneShallow(rep)
+	}
+	return nil
+}
+
+// pruneShallow drops the shallow commits whose parents were fetched since. go-git keeps
+// them when history is deepened, and the server would otherwise send their history again.
+func pruneShallow(rep *git.Repository) error {
+	shallows, err := rep.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("read shallow commits: %w", err)
+	}
+
+	kept := make([]plumbing.Hash, 0, len(shallows))
+	for _, hash := range shallows {
+		commit, err := rep.CommitObject(hash)
+		if err != nil {
+			kept = append(kept, hash)
+			continue
+		}
+		for _, parent := range commit.ParentHashes {
+			if !hasCommit(rep, parent) {
+				kept = append(kept, hash)
+				break
+			}
+		}
+	}
+
+	if len(kept) == len(shallows) {
+		return nil
+	}
+	if err := rep.Storer.SetShallow(kept); err != nil {
+		return fmt.Errorf("write shallow commits: %w", err)
+	}
+	return nil
+}
+
+func isShallow(rep *git.Repository) bool {
+	shallows, err := rep.Storer.Shallow()
+	return err == nil && len(shallows) > 0
+}
+
+// isEmpty reports whether nothing was fetched into rep yet.
+func isEmpty(rep *git.Repository) bool {
+	iter, err := rep.References()
+	if err != nil {
+		return true
+	}
+	defer iter.Close()
+
+	empty := true
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			empty = false
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return empty
+}
+
+func hasCommit(rep *git.Repository, hash plumbing.Hash) bool {
+	_, err := rep.CommitObject(hash)
+	return err == nil
+}
+
+func branchRefSpec(branch string) gitconfig.RefSpec {
+	return gitconfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch))
+}
+
+func hasReference(refs []*plumbing.Reference, name plumbing.ReferenceName) bool {
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteBranch returns branch when the remote has it. Like resolveReference, main is used
+// when master does not exist.
+func remoteBranch(refs []*plumbing.Reference, branch string) string {
+	if hasReference(refs, plumbing.NewBranchReferenceName(branch)) {
+		return branch
+	}
+	if branch == "master" && hasReference(refs, plumbing.NewBranchReferenceName("main")) {
+		return "main"
+	}
+	return ""
+}
+
+// remoteTagNames lists the short names of the tags the remote advertises.
+func remoteTagNames(refs []*plumbing.Reference) []string {
+	tags := make([]string, 0)
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+	return tags
+}
+
+// latestTag returns the newest semver tag in tags or, when the dependency has a version,
+// the highest one it allows, so that a range is not behind because of tags it excludes.
+func (r *github) latestTag(tags []string) (string, error) {
+	if r.dep.Version == "" {
+		return semver.Latest(tags), nil
+	}
+	constraint, err := semver.ParseConstraint(r.dep.Version)
+	if err != nil {
+		return "", err
+	}
+	return constraint.Highest(tags), nil
+}
+
+// resolveVersion returns the highest tag matching the version constraint of the dependency.
+func (r *github) resolveVersion(tags []string) (string, error) {
+	constraint, err := semver.ParseConstraint(r.dep.Version)
+	if err != nil {
+		return "", err
+	}
+
+	tag := constraint.Highest(tags)
+	if tag == "" {
+		return "", fmt.Errorf("no tag of %s matches version %s", r.dep.Repository(), r.dep.Version)
+	}
+	logger.Info("version %s resolved to %s", r.dep.Version, tag)
+
+	return tag, nil
+}
+
+// tagNames lists the short names of all tags in the repository.
+func (r *github) tagNames(rep *git.Repository) ([]string, error) {
+	iter, err := rep.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+
+	tags := make([]string, 0)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// tagCommit returns the commit a tag points to, peeling annotated tags.
+func (r *github) tagCommit(rep *git.Repository, tag string) (plumbing.Hash, error) {
+	hash, err := rep.ResolveRevision(plumbing.Revision(plumbing.NewTagReferenceName(tag)))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("resolve tag %s: %w", tag, err)
+	}
+	return *hash, nil
+}
+
 func (r *github) resolveReference(rep *git.Repository, branch string) (*plumbing.Reference, error) {
 	if branch != "master" {
 		return r.getReference(rep, branch)
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/auth"
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func TestGitOpenTimeout(t *testing.T) {
+	// A git server that never answers.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authProvider := auth.NewMockAuthProvider(ctrl)
+	authProvider.EXPECT().AuthMethod(gomock.Any()).Return(nil, nil)
+	authProvider.EXPECT().GetRepositoryURL(gomock.Any()).Return(server.URL + "/hung.git")
+
+	protodepDir := t.TempDir()
+	dep := config.ProtoDepDependency{Target: "github.com/stormcat24/hung"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := NewGit(protodepDir, dep, authProvider).Open(ctx)
+	require.Error(t, err)
+	require.True(t, errors.Is(ctx.Err(), context.DeadlineExceeded))
+
+	// The partial clone is removed, so the next run clones again.
+	_, err = os.Stat(filepath.Join(protodepDir, "github.com", "stormcat24", "hung"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestArchiveOpenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewArchive(t.TempDir(), config.ProtoDepDependency{Target: "example", URL: "http://127.0.0.1:1/a.tar.gz"}).Open(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+// local is a directory on disk. Its files are copied as they are, so it has no revision.
+type local struct {
+	dep     config.ProtoDepDependency
+	baseDir string
+}
+
+func NewLocal(dep config.ProtoDepDependency, opt ...Option) Source {
+	opts := newOptions(opt)
+
+	return &local{
+		dep:     dep,
+		baseDir: opts.baseDir,
+	}
+}
+
+func (l *local) Open(_ context.Context) (*OpenedRepository, error) {
+	dir := l.ProtoRootDir()
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open local source: %w", err)
+	}
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("open local source: %s is not a directory", dir)
+	}
+
+	return &OpenedRepository{
+		Dep: l.dep,
+	}, nil
+}
+
+func (l *local) ProtoRootDir() string {
+	dir := filepath.FromSlash(l.dep.Target)
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(l.baseDir, dir)
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stormcat24/protodep/pkg/auth"
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+// ErrNotCached is returned in offline mode when a repository or revision is not in the .protodep cache.
+var ErrNotCached = errors.New("not found in the .protodep cache")
+
+// Source provides the .proto files of a dependency.
+type Source interface {
+	// Open makes the files of the dependency available under ProtoRootDir. Downloads stop
+	// when ctx is done.
+	Open(ctx context.Context) (*OpenedRepository, error)
+	ProtoRootDir() string
+}
+
+type options struct {
+	offline bool
+	baseDir string
+}
+
+type funcOption struct {
+	f func(options *options)
+}
+
+func (fo *funcOption) apply(do *options) {
+	fo.f(do)
+}
+
+type Option interface {
+	apply(*options)
+}
+
+// WithOffline resolves the source only from the .protodep cache, without network access.
+func WithOffline() Option {
+	return &funcOption{
+		f: func(options *options) {
+			options.offline = true
+		},
+	}
+}
+
+// WithBaseDir sets the directory relative paths of local sources are resolved from.
+func WithBaseDir(dir string) Option {
+	return &funcOption{
+		f: func(options *options) {
+			options.baseDir = dir
+		},
+	}
+}
+
+func newOptions(opt []Option) options {
+	var opts options
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	return opts
+}
+
+// NewSource returns the Source selected by the source setting of dep. authProvider is
+// only used by git sources.
+func NewSource(protodepDir string, dep config.ProtoDepDependency, authProvider auth.AuthProvider, opt ...Option) (Source, error) {
+	switch dep.SourceKind() {
+	case config.SourceGit:
+		return NewGit(protodepDir, dep, authProvider, opt...), nil
+	case config.SourceArchive:
+		return NewArchive(protodepDir, dep, opt...), nil
+	case config.SourceLocal:
+		return NewLocal(dep, opt...), nil
+	case config.SourceBSR:
+		return NewBSR(protodepDir, dep, opt...)
+	default:
+		return nil, fmt.Errorf("%s source is not accepted (git, archive, local or bsr)", dep.Source)
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// StatusError is an HTTP response with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	// Message is the error returned by the server, Status when it returned none.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// IsTransient reports whether err is a network failure that may not happen again, such
+// as a timeout, a reset connection or a 5xx response. Authentication failures, missing
+// repositories and other errors are not transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return isTransientStatus(statusErr.StatusCode)
+	}
+
+	// go-git reports unexpected statuses of git servers without wrapping them.
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var httpErr *githttp.Err
+		if errors.As(unexpected.Err, &httpErr) {
+			return isTransientStatus(httpErr.Response.StatusCode)
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsTemporary {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func isTransientStatus(code int) bool {
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"download 503", fmt.Errorf("download x: %w", &StatusError{StatusCode: http.StatusServiceUnavailable, Message: "503 Service Unavailable"}), true},
+		{"download 429", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"download 404", &StatusError{StatusCode: http.StatusNotFound}, false},
+		{"git 500", fmt.Errorf("clone repository: %w", plumbing.NewUnexpectedError(&githttp.Err{Response: &http.Response{StatusCode: http.StatusInternalServerError}})), true},
+		{"git authentication", fmt.Errorf("clone repository: %w", transport.ErrAuthenticationRequired), false},
+		{"git not found", transport.ErrRepositoryNotFound, false},
+		{"connection reset", fmt.Errorf("fetch repository: %w", syscall.ECONNRESET), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"canceled", context.Canceled, false},
+		{"not cached", ErrNotCached, false},
+		{"other", errors.New("checkout to v1: reference not found"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IsTransient(tt.err))
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package resolver
 
+import "time"
+
 type Config struct {
 	// UseHttps will force https on each proto dependencies fetch.
 	UseHttps bool
@@ -10,7 +12,7 @@ type Config struct {
 	// TargetDir is the dependencies directory where protodep.toml files are located.
 	TargetDir string
 
-	// OutputDir is the directory where proto files will be cloned.
+	// OutputDir is the directory where proto files will be cloned. Defaults to TargetDir.
 	OutputDir string
 
 	// BasicAuthUsername is used if `https` mode  is enable. Optional, only if dependency repository needs authentication.
@@ -24,4 +26,48 @@ type Config struct {
 
 	// IdentityPassword is used if `ssh` mode is enable. Optional, only if identity file needs a passphrase.
 	IdentityPassword string
+
+	// Jobs is the number of dependencies resolved concurrently. Values less than 1 are treated as 1.
+	Jobs int
+
+	// Offline resolves dependencies only from the clones under {home}/.protodep, without network access.
+	Offline bool
+
+	// StrictImports fails the resolution when an import of a vendored file does not resolve.
+	StrictImports bool
+
+	// FetchTimeout bounds the time spent fetching a single dependency. Zero means no limit.
+	FetchTimeout time.Duration
+
+	// Retries is the number of times a fetch failing with a transient network error, such
+	// as a timeout or a 5xx response, is attempted again.
+	Retries int
+
+	// RetryBackoff is the wait before the first retry. It doubles after each retry.
+	RetryBackoff time.Duration
+}
+
+func (c *Config) outputDir() string {
+	if c.OutputDir == "" {
+		return c.TargetDir
+	}
+	return c.OutputDir
+}
+
+// Options control a single Resolve or Plan call.
+type Options struct {
+	// ForceUpdate resolves protodep.toml again instead of the revisions in protodep.lock.
+	ForceUpdate bool
+
+	// CleanupCache removes the clones under {home}/.protodep first. Not allowed by Plan.
+	CleanupCache bool
+
+	// Targets limits a force update to these dependencies, named by target or by Key. A
+	// target names all its entries. The other dependencies keep their revisions in
+	// protodep.lock.
+	Targets []string
+
+	// KeepGoing resolves the other dependencies when one fails, and returns a
+	// *DependenciesError listing every failure. Nothing is written when one failed.
+	KeepGoing bool
 }
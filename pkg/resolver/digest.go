@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+const digestPrefix = "sha256:"
+
+// fileDigest returns the digest recorded in protodep.lock for a vendored file.
+func fileDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return digestPrefix + hex.EncodeToString(sum[:])
+}
+
+// treeDigest returns the digest of a set of files. It only depends on their paths and
+// digests, not on their order.
+func treeDigest(files []config.ProtoDepFile) string {
+	lines := make([]string, 0, len(files))
+	for _, file := range files {
+		lines = append(lines, fmt.Sprintf("%s  %s\n", file.Hash, file.Path))
+	}
+	sort.Strings(lines)
+
+	return fileDigest([]byte(strings.Join(lines, "")))
+}
+
+// checkIntegrity refuses a resolved dependency whose content differs from what protodep.lock
+// recorded for the same revision, or whose tag now points to another commit. Like go.sum,
+// this detects upstream tags that were rewritten.
+func checkIntegrity(locked *config.ProtoDepDependency, resolved *config.ProtoDepDependency) error {
+	// Local sources have no revision, their content is expected to change.
+	if locked == nil || resolved.SourceKind() == config.SourceLocal {
+		return nil
+	}
+
+	if locked.Tag != "" && locked.Tag == resolved.Tag && locked.Revision != resolved.Revision {
+		return fmt.Errorf("integrity check failed for %s: tag %s now points to %s, but protodep.lock has %s; the tag may have been rewritten upstream",
+			resolved.Target, resolved.Tag, resolved.Revision, locked.Revision)
+	}
+
+	if locked.TreeHash == "" || pinnedRevision(locked) != pinnedRevision(resolved) || !sameSelection(locked, resolved) {
+		return nil
+	}
+
+	if locked.TreeHash != resolved.TreeHash {
+		lockedFiles := make(map[string]string, len(locked.Files))
+		for _, file := range locked.Files {
+			lockedFiles[file.Path] = file.Hash
+		}
+
+		changed := make([]string, 0)
+		for _, file := range resolved.Files {
+			if hash, ok := lockedFiles[file.Path]; !ok || hash != file.Hash {
+				changed = append(changed, file.Path)
+			}
+			delete(lockedFiles, file.Path)
+		}
+		for path := range lockedFiles {
+			changed = append(changed, path)
+		}
+		sort.Strings(changed)
+
+		return fmt.Errorf("integrity check failed for %s at %s: tree hash %s does not match %s in protodep.lock (changed: %s)",
+			resolved.Target, pinnedRevision(resolved), resolved.TreeHash, locked.TreeHash, strings.Join(changed, ", "))
+	}
+
+	return nil
+}
+
+// pinnedRevision returns what identifies the content of a dependency: the commit hash of
+// git sources or the sha256 of archive sources.
+func pinnedRevision(dep *config.ProtoDepDependency) string {
+	if dep.SourceKind() == config.SourceArchive {
+		return dep.SHA256
+	}
+	return dep.Revision
+}
+
+// sameSelection reports whether both dependencies select the same files from a revision.
+func sameSelection(a *config.ProtoDepDependency, b *config.ProtoDepDependency) bool {
+	return a.Path == b.Path && a.Subdir == b.Subdir && a.ResolveImports == b.ResolveImports &&
+		strings.Join(a.Includes, "\n") == strings.Join(b.Includes, "\n") &&
+		strings.Join(a.Ignores, "\n") == strings.Join(b.Ignores, "\n")
+}
@@ -0,0 +1,60 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func TestTreeDigest(t *testing.T) {
+	a := config.ProtoDepFile{Path: "a.proto", Hash: fileDigest([]byte("a"))}
+	b := config.ProtoDepFile{Path: "b.proto", Hash: fileDigest([]byte("b"))}
+
+	require.Equal(t, treeDigest([]config.ProtoDepFile{a, b}), treeDigest([]config.ProtoDepFile{b, a}))
+	require.NotEqual(t, treeDigest([]config.ProtoDepFile{a, b}), treeDigest([]config.ProtoDepFile{a}))
+
+	renamed := config.ProtoDepFile{Path: "c.proto", Hash: b.Hash}
+	require.NotEqual(t, treeDigest([]config.ProtoDepFile{a, b}), treeDigest([]config.ProtoDepFile{a, renamed}))
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	files := []config.ProtoDepFile{
+		{Path: "a.proto", Hash: fileDigest([]byte("a"))},
+		{Path: "b.proto", Hash: fileDigest([]byte("b"))},
+	}
+	locked := &config.ProtoDepDependency{
+		Target:   "github.com/stormcat24/upstream",
+		Revision: "d7ee1d95b6700756b293b722a1cfd4b905a351ba",
+		Tag:      "v1.0.0",
+		TreeHash: treeDigest(files),
+		Files:    files,
+	}
+
+	require.NoError(t, checkIntegrity(nil, locked))
+
+	same := *locked
+	require.NoError(t, checkIntegrity(locked, &same))
+
+	rewrittenTag := *locked
+	rewrittenTag.Revision = "c6f7a5ac629444a556bb665e389e41b897ebad39"
+	require.ErrorContains(t, checkIntegrity(locked, &rewrittenTag), "tag v1.0.0 now points to")
+
+	newTag := rewrittenTag
+	newTag.Tag = "v1.1.0"
+	require.NoError(t, checkIntegrity(locked, &newTag))
+
+	changedFiles := []config.ProtoDepFile{
+		{Path: "a.proto", Hash: fileDigest([]byte("changed"))},
+		{Path: "b.proto", Hash: fileDigest([]byte("b"))},
+	}
+	changed := *locked
+	changed.Files = changedFiles
+	changed.TreeHash = treeDigest(changedFiles)
+	require.ErrorContains(t, checkIntegrity(locked, &changed), "changed: a.proto")
+
+	reselected := changed
+	reselected.Ignores = []string{"c.proto"}
+	require.NoError(t, checkIntegrity(locked, &reselected))
+}
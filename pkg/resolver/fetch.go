@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/repository"
+)
+
+// fetch calls f to get dep from its remote. Each attempt is bounded by conf.FetchTimeout,
+// and transient failures are attempted again up to conf.Retries times, waiting
+// conf.RetryBackoff and then twice as long after each attempt.
+func (s *resolver) fetch(ctx context.Context, dep config.ProtoDepDependency, f func(ctx context.Context) error) error {
+	attempts := s.conf.Retries + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := s.conf.RetryBackoff
+
+	// failed adds the number of attempts to err once the fetch was retried.
+	failed := func(err error, attempt int) error {
+		if attempt > 1 {
+			return fmt.Errorf("%s failed after %d attempts: %w", dep.Target, attempt, err)
+		}
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		logger.Info("fetching %s, attempt %d of %d", dep.Target, attempt, attempts)
+
+		fetchCtx, cancel := s.withFetchTimeout(ctx)
+		err := f(fetchCtx)
+		timedOut := ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		if timedOut {
+			err = fmt.Errorf("fetch %s: timed out after %s: %w", dep.Target, s.conf.FetchTimeout, err)
+		}
+
+		if (!timedOut && !repository.IsTransient(err)) || ctx.Err() != nil || attempt == attempts {
+			return failed(err, attempt)
+		}
+
+		logger.Warn("attempt %d of %d to fetch %s failed, retrying in %s: %v", attempt, attempts, dep.Target, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return failed(ctx.Err(), attempt)
+		}
+		backoff *= 2
+	}
+}
+
+// withFetchTimeout bounds a single attempt to fetch a dependency by conf.FetchTimeout.
+func (s *resolver) withFetchTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.conf.FetchTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.conf.FetchTimeout)
+}
@@ -0,0 +1,357 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/repository"
+	"github.com/stormcat24/protodep/pkg/semver"
+)
+
+// requirement is the revision of a repository a dependency asks for.
+type requirement struct {
+	revision string
+	branch   string
+	version  string
+}
+
+func requirementOf(dep config.ProtoDepDependency) requirement {
+	return requirement{
+		revision: dep.Revision,
+		branch:   dep.Branch,
+		version:  dep.Version,
+	}
+}
+
+func (r requirement) apply(dep *config.ProtoDepDependency) {
+	dep.Revision = r.revision
+	dep.Branch = r.branch
+	dep.Version = r.version
+}
+
+func (r requirement) String() string {
+	switch {
+	case r.revision != "":
+		return r.revision
+	case r.version != "":
+		return "version " + r.version
+	case r.branch != "":
+		return "branch " + r.branch
+	default:
+		return "default branch"
+	}
+}
+
+type graphNode struct {
+	dep config.ProtoDepDependency
+	// chain lists the repositories from a top-level dependency down to dep, excluding dep.
+	chain []string
+}
+
+type dependencyGraph struct {
+	ctx         context.Context
+	resolver    *resolver
+	protodepDir string
+	strategy    string
+	keepGoing   bool
+
+	// failures are the dependencies that could not be walked with keepGoing.
+	failures []*DependencyError
+
+	// children caches the dependencies declared by a repository at a requirement.
+	children map[string][]config.ProtoDepDependency
+	// tags caches the tag a repository is checked out at for a requirement.
+	tags map[string]string
+	// defaultBranches caches the default branch of a repository.
+	defaultBranches map[string]string
+}
+
+// expandTransitive returns the top-level dependencies followed by the dependencies declared
+// in protodep.toml of each dependency repository, recursively, in breadth-first order.
+// Conflicting revisions of the same repository are resolved with the conflict strategy.
+// With keepGoing, the dependencies that cannot be walked are left out, and returned with
+// the others in a *DependenciesError.
+func (s *resolver) expandTransitive(ctx context.Context, protodep *config.ProtoDep, protodepDir string, keepGoing bool) ([]config.ProtoDepDependency, error) {
+	strategy := protodep.ConflictStrategy
+	if strategy == "" {
+		strategy = config.ConflictError
+	}
+
+	g := &dependencyGraph{
+		ctx:         ctx,
+		resolver:    s,
+		protodepDir: protodepDir,
+		strategy:    strategy,
+		keepGoing:   keepGoing,
+		children:    make(map[string][]config.ProtoDepDependency),
+		tags:        make(map[string]string),
+
+		defaultBranches: make(map[string]string),
+	}
+
+	// A higher revision found by the "highest" strategy may declare other dependencies,
+	// so the graph is walked again until the chosen revisions no longer change.
+	overrides := make(map[string]requirement)
+	for {
+		deps, changed, err := g.walk(protodep.Dependencies, overrides)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			continue
+		}
+		if len(g.failures) > 0 {
+			return deps, &DependenciesError{Errors: g.failures, Total: len(deps) + len(g.failures)}
+		}
+		return deps, nil
+	}
+}
+
+// walk visits the graph from roots. It returns changed = true when it added an override
+// and the graph has to be walked again.
+func (g *dependencyGraph) walk(roots []config.ProtoDepDependency, overrides map[string]requirement) ([]config.ProtoDepDependency, bool, error) {
+	chosen := make(map[string]requirement)
+	chosenBy := make(map[string]string)
+	seen := make(map[string]bool)
+	g.failures = nil
+
+	queue := make([]graphNode, 0, len(roots))
+	for _, dep := range roots {
+		queue = append(queue, graphNode{dep: dep})
+	}
+
+	result := make([]config.ProtoDepDependency, 0, len(roots))
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		dep := node.dep
+		repo := sourceKey(dep)
+
+		if err := detectCycle(node.chain, repo); err != nil {
+			if err := g.fail(dep, err); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		if override, ok := overrides[repo]; ok {
+			override.apply(&dep)
+		} else if current, ok := chosen[repo]; !ok {
+			chosen[repo] = requirementOf(dep)
+			chosenBy[repo] = requiredBy(dep)
+		} else if required := requirementOf(dep); required != current && dep.Via != "" {
+			same, err := g.isSame(dep, required, current)
+			if err != nil {
+				if err := g.fail(dep, fmt.Errorf("cannot compare the revisions of %s: %w", repo, err)); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+			switch {
+			case same:
+				// The default branch and its name are not a conflict.
+			case g.strategy == config.ConflictFirstWins:
+				logger.Warn("%s requires %s at %s, using %s required by %s", requiredBy(dep), repo, required, current, chosenBy[repo])
+				current.apply(&dep)
+			case g.strategy == config.ConflictHighest:
+				higher, err := g.isHigher(dep, required, current)
+				if err != nil {
+					if err := g.fail(dep, fmt.Errorf("cannot choose the highest revision of %s: %w", repo, err)); err != nil {
+						return nil, false, err
+					}
+					continue
+				}
+				if higher {
+					overrides[repo] = required
+					return nil, true, nil
+				}
+				current.apply(&dep)
+			default:
+				err := fmt.Errorf("conflicting revisions of %s: %s requires %s, but %s requires %s",
+					repo, chosenBy[repo], current, requiredBy(dep), required)
+				if err := g.fail(dep, err); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+		}
+
+		// The same transitive dependency is often declared by several repositories.
+		key := lockKey(dep)
+		if seen[key] && dep.Via != "" {
+			continue
+		}
+		seen[key] = true
+
+		children, err := g.childrenOf(dep)
+		if err != nil {
+			if err := g.fail(dep, err); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		result = append(result, dep)
+
+		chain := append(append([]string{}, node.chain...), repo)
+		for _, child := range children {
+			child.Via = dep.Target
+			queue = append(queue, graphNode{dep: child, chain: chain})
+		}
+	}
+
+	return result, false, nil
+}
+
+// detectCycle fails when repo is already in chain.
+func detectCycle(chain []string, repo string) error {
+	for i, ancestor := range chain {
+		if ancestor == repo {
+			cycle := append(append([]string{}, chain[i:]...), repo)
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// fail returns err, or records it for dep and returns nil with keepGoing, so that the
+// other dependencies are still walked.
+func (g *dependencyGraph) fail(dep config.ProtoDepDependency, err error) error {
+	if !g.keepGoing {
+		return err
+	}
+	for _, failure := range g.failures {
+		if failure.Target == dep.Target && failure.Path == dep.Path {
+			return nil
+		}
+	}
+	g.failures = append(g.failures, &DependencyError{Target: dep.Target, Path: dep.Path, Err: err})
+	return nil
+}
+
+// requiredBy names the declaring side of dep for messages.
+func requiredBy(dep config.ProtoDepDependency) string {
+	if dep.Via == "" {
+		return "protodep.toml"
+	}
+	return dep.Via
+}
+
+// isSame reports whether a and b ask for the same revision of the repository of dep, where
+// an empty branch of a git repository is its default branch.
+func (g *dependencyGraph) isSame(dep config.ProtoDepDependency, a requirement, b requirement) (bool, error) {
+	if a.branch == "" {
+		a, b = b, a
+	}
+	// Only a branch and the default branch of the same repository may still be the same.
+	if a == b || b.branch != "" || a.revision != b.revision || a.version != b.version || dep.SourceKind() != config.SourceGit {
+		return a == b, nil
+	}
+
+	branch, ok := g.defaultBranches[dep.Repository()]
+	if !ok {
+		var err error
+		branch, err = g.resolver.DefaultBranch(g.ctx, dep)
+		if err != nil {
+			return false, err
+		}
+		g.defaultBranches[dep.Repository()] = branch
+	}
+	b.branch = branch
+	return a == b, nil
+}
+
+// isHigher reports whether a asks for a higher semver tag of the repository of dep than b.
+// Version constraints are compared by the tags they resolve to.
+func (g *dependencyGraph) isHigher(dep config.ProtoDepDependency, a requirement, b requirement) (bool, error) {
+	av, err := g.versionOf(dep, a)
+	if err != nil {
+		return false, err
+	}
+	bv, err := g.versionOf(dep, b)
+	if err != nil {
+		return false, err
+	}
+	return av.Compare(bv) > 0, nil
+}
+
+// versionOf returns the semver version req asks for in the repository of dep.
+func (g *dependencyGraph) versionOf(dep config.ProtoDepDependency, req requirement) (*semver.Version, error) {
+	tag := req.revision
+	if req.version != "" {
+		req.apply(&dep)
+		key := requirementKey(dep)
+		if _, ok := g.tags[key]; !ok {
+			if err := g.open(dep); err != nil {
+				return nil, err
+			}
+		}
+		tag = g.tags[key]
+	}
+
+	v, err := semver.Parse(tag)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a semver tag", req)
+	}
+	return v, nil
+}
+
+// open checks out dep in the cache and records the tag it resolved to.
+func (g *dependencyGraph) open(dep config.ProtoDepDependency) error {
+	gitrepo, err := g.resolver.newGit(dep, g.protodepDir)
+	if err != nil {
+		return err
+	}
+	var opened *repository.OpenedRepository
+	err = g.resolver.fetch(g.ctx, dep, func(ctx context.Context) error {
+		opened, err = gitrepo.Open(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	g.tags[requirementKey(dep)] = opened.Tag
+	return nil
+}
+
+// requirementKey identifies the repository of dep at its requirement.
+func requirementKey(dep config.ProtoDepDependency) string {
+	return dep.Repository() + "@" + requirementOf(dep).String()
+}
+
+// childrenOf checks out dep and returns the dependencies declared in protodep.toml at the
+// root of its repository, if there is one. Only git sources declare dependencies.
+func (g *dependencyGraph) childrenOf(dep config.ProtoDepDependency) ([]config.ProtoDepDependency, error) {
+	if dep.SourceKind() != config.SourceGit {
+		return nil, nil
+	}
+
+	key := requirementKey(dep)
+	if children, ok := g.children[key]; ok {
+		return children, nil
+	}
+
+	if err := g.open(dep); err != nil {
+		return nil, err
+	}
+
+	var children []config.ProtoDepDependency
+
+	repoDir := filepath.Join(g.protodepDir, dep.Repository())
+	if _, err := os.Stat(filepath.Join(repoDir, "protodep.toml")); err == nil {
+		nested, err := config.NewDependency(repoDir, true).Load()
+		if err != nil {
+			return nil, fmt.Errorf("load protodep.toml of %s: %w", dep.Repository(), err)
+		}
+		logger.Info("found %d dependencies in protodep.toml of %s", len(nested.Dependencies), dep.Repository())
+		children = nested.Dependencies
+	}
+
+	g.children[key] = children
+	return children, nil
+}
@@ -0,0 +1,201 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+// newTransitiveTarget creates repositories for github.com/graph/{a,b,c} where a and c both
+// depend on b, with the requirements aRequires and cRequires, and returns a resolver for a
+// protodep.toml depending on a and c. b has the tags v1.0.0, v1.1.0 and v2.0.0.
+func newTransitiveTarget(t *testing.T, strategy string, aRequires string, cRequires string) (Resolver, string, string) {
+	t.Helper()
+
+	repoB := newTestRepository(t, map[string]string{
+		"proto/b.proto": `syntax = "proto3"; // v1.0.0`,
+	})
+	tagTestRepository(t, repoB, "v1.0.0", headOf(t, repoB))
+	tagTestRepository(t, repoB, "v1.1.0", commitTestFiles(t, repoB, map[string]string{
+		"proto/b.proto": `syntax = "proto3"; // v1.1.0`,
+	}))
+	tagTestRepository(t, repoB, "v2.0.0", commitTestFiles(t, repoB, map[string]string{
+		"proto/b.proto": `syntax = "proto3"; // v2.0.0`,
+	}))
+
+	repoA := newTestRepository(t, map[string]string{
+		"proto/a.proto": `syntax = "proto3";`,
+		"protodep.toml": fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/graph/b/proto"
+  %s
+  path = "b"
+`, aRequires),
+	})
+	repoC := newTestRepository(t, map[string]string{
+		"proto/c.proto": `syntax = "proto3";`,
+		"protodep.toml": fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/graph/b/proto"
+  %s
+  path = "b"
+`, cRequires),
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), fmt.Sprintf(`proto_outdir = "./proto"
+transitive = true
+conflict_strategy = "%s"
+
+[[dependencies]]
+  target = "github.com/graph/a/proto"
+  path = "a"
+
+[[dependencies]]
+  target = "github.com/graph/c/proto"
+  path = "c"
+`, strategy))
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/graph/a": repoA,
+		"github.com/graph/b": repoB,
+		"github.com/graph/c": repoC,
+	})
+
+	return target, targetDir, outputDir
+}
+
+func TestResolveTransitive(t *testing.T) {
+	cases := []struct {
+		strategy string
+		tag      string
+	}{
+		{config.ConflictHighest, "v1.1.0"},
+		{config.ConflictFirstWins, "v1.0.0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.strategy, func(t *testing.T) {
+			target, targetDir, outputDir := newTransitiveTarget(t, tc.strategy, `revision = "v1.0.0"`, `revision = "v1.1.0"`)
+
+			_, err := target.Resolve(context.Background(), Options{})
+			require.NoError(t, err)
+
+			require.True(t, isFileExist(filepath.Join(outputDir, "proto/a/a.proto")))
+			require.True(t, isFileExist(filepath.Join(outputDir, "proto/c/c.proto")))
+
+			content := readTestFile(t, filepath.Join(outputDir, "proto/b/b.proto"))
+			require.Equal(t, `syntax = "proto3"; // `+tc.tag, content)
+
+			lock, err := config.NewDependency(targetDir, false).LoadLock()
+			require.NoError(t, err)
+			require.True(t, lock.Transitive)
+			require.Len(t, lock.Dependencies, 3)
+			require.Equal(t, "github.com/graph/b/proto", lock.Dependencies[2].Target)
+			require.Equal(t, tc.tag, lock.Dependencies[2].Tag)
+			require.Equal(t, "github.com/graph/a/proto", lock.Dependencies[2].Via)
+
+			// protodep.lock is flat, so resolving from it does not walk the graph again.
+			_, err = target.Resolve(context.Background(), Options{})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestResolveTransitiveHighestVersion(t *testing.T) {
+	// ~1.0 resolves to v1.0.0 and ^1.0.0 to v1.1.0, the higher one.
+	target, targetDir, outputDir := newTransitiveTarget(t, config.ConflictHighest, `version = "~1.0"`, `version = "^1.0.0"`)
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3"; // v1.1.0`, readTestFile(t, filepath.Join(outputDir, "proto/b/b.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, "^1.0.0", lock.Dependencies[2].Version)
+	require.Equal(t, "v1.1.0", lock.Dependencies[2].Tag)
+}
+
+func TestResolveTransitiveConflict(t *testing.T) {
+	target, _, _ := newTransitiveTarget(t, config.ConflictError, `revision = "v1.0.0"`, `revision = "v1.1.0"`)
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.ErrorContains(t, err, "conflicting revisions of github.com/graph/b: github.com/graph/a/proto requires v1.0.0, but github.com/graph/c/proto requires v1.1.0")
+}
+
+func TestResolveTransitiveDefaultBranch(t *testing.T) {
+	// master is the default branch of b, so both require the same revision.
+	target, _, outputDir := newTransitiveTarget(t, config.ConflictError, `branch = "master"`, ``)
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3"; // v2.0.0`, readTestFile(t, filepath.Join(outputDir, "proto/b/b.proto")))
+}
+
+func TestResolveTransitiveCycle(t *testing.T) {
+	repoD := newTestRepository(t, map[string]string{
+		"proto/d.proto": `syntax = "proto3";`,
+		"protodep.toml": `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/graph/e/proto"
+`,
+	})
+	repoE := newTestRepository(t, map[string]string{
+		"proto/e.proto": `syntax = "proto3";`,
+		"protodep.toml": `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/graph/d/proto"
+  path = "d"
+`,
+	})
+
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+transitive = true
+
+[[dependencies]]
+  target = "github.com/graph/d/proto"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: t.TempDir(),
+	}, map[string]string{
+		"github.com/graph/d": repoD,
+		"github.com/graph/e": repoE,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.ErrorContains(t, err, "dependency cycle detected: github.com/graph/d -> github.com/graph/e -> github.com/graph/d")
+}
+
+func TestResolveTransitiveKeepGoing(t *testing.T) {
+	target, targetDir, outputDir := newTransitiveTarget(t, config.ConflictError, `revision = "v1.0.0"`, `revision = "v1.1.0"`)
+
+	_, err := target.Resolve(context.Background(), Options{KeepGoing: true})
+	var depsErr *DependenciesError
+	require.ErrorAs(t, err, &depsErr)
+	require.Equal(t, 4, depsErr.Total)
+	require.Len(t, depsErr.Errors, 1)
+	require.Equal(t, "github.com/graph/b/proto", depsErr.Errors[0].Target)
+	require.ErrorContains(t, depsErr.Errors[0], "conflicting revisions of github.com/graph/b")
+
+	// Nothing is written when one failed.
+	require.NoDirExists(t, filepath.Join(outputDir, "proto"))
+	require.NoFileExists(t, filepath.Join(targetDir, "protodep.lock"))
+}
@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/protoimport"
+)
+
+// wellKnownImports are shipped with protoc and resolve without being vendored.
+var wellKnownImports = map[string]bool{
+	"google/protobuf/any.proto":             true,
+	"google/protobuf/api.proto":             true,
+	"google/protobuf/descriptor.proto":      true,
+	"google/protobuf/duration.proto":        true,
+	"google/protobuf/empty.proto":           true,
+	"google/protobuf/field_mask.proto":      true,
+	"google/protobuf/source_context.proto":  true,
+	"google/protobuf/struct.proto":          true,
+	"google/protobuf/timestamp.proto":       true,
+	"google/protobuf/type.proto":            true,
+	"google/protobuf/wrappers.proto":        true,
+	"google/protobuf/compiler/plugin.proto": true,
+}
+
+// UnresolvedImport is an import of a vendored file that does not resolve.
+type UnresolvedImport struct {
+	// File is the importing file, relative to proto_outdir.
+	File string
+	Line int
+	// Import is the imported path as written in File.
+	Import string
+}
+
+func (u UnresolvedImport) String() string {
+	return fmt.Sprintf("%s:%d: import \"%s\" not found", u.File, u.Line, u.Import)
+}
+
+// checkImports scans the vendored files of deps and returns the imports that resolve neither
+// under outdir, nor under one of importPaths, nor to a well-known type.
+func checkImports(outdir string, importPaths []string, deps []config.ProtoDepDependency) ([]UnresolvedImport, error) {
+	unresolved := make([]UnresolvedImport, 0)
+	for _, dep := range deps {
+		for _, file := range dep.Files {
+			content, err := os.ReadFile(filepath.Join(outdir, filepath.FromSlash(file.Path)))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, imp := range protoimport.Parse(content) {
+				if !isImportResolvable(imp.Path, outdir, importPaths) {
+					unresolved = append(unresolved, UnresolvedImport{
+						File:   file.Path,
+						Line:   imp.Line,
+						Import: imp.Path,
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(unresolved, func(i, j int) bool {
+		return unresolved[i].File < unresolved[j].File
+	})
+
+	return unresolved, nil
+}
+
+func isImportResolvable(path string, outdir string, importPaths []string) bool {
+	if wellKnownImports[path] {
+		return true
+	}
+
+	for _, dir := range append([]string{outdir}, importPaths...) {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path))); err == nil {
+			return true
+		}
+	}
+	return false
+}
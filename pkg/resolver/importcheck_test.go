@@ -0,0 +1,49 @@
+package resolver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func TestCheckImports(t *testing.T) {
+	outdir := t.TempDir()
+	systemDir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(outdir, "a/service.proto"), `syntax = "proto3";
+import "a/model.proto";
+import "google/protobuf/empty.proto";
+import "validate/validate.proto";
+import "missing/first.proto";
+`)
+	writeTestFile(t, filepath.Join(outdir, "a/model.proto"), `syntax = "proto3";
+
+import "missing/second.proto";
+`)
+	writeTestFile(t, filepath.Join(systemDir, "validate/validate.proto"), `syntax = "proto3";`)
+
+	deps := []config.ProtoDepDependency{
+		{
+			Target: "github.com/stormcat24/upstream",
+			Files: []config.ProtoDepFile{
+				{Path: "a/service.proto"},
+				{Path: "a/model.proto"},
+			},
+		},
+	}
+
+	unresolved, err := checkImports(outdir, []string{systemDir}, deps)
+	require.NoError(t, err)
+	require.Equal(t, []UnresolvedImport{
+		{File: "a/model.proto", Line: 3, Import: "missing/second.proto"},
+		{File: "a/service.proto", Line: 5, Import: "missing/first.proto"},
+	}, unresolved)
+	require.Equal(t, `a/model.proto:3: import "missing/second.proto" not found`, unresolved[0].String())
+
+	unresolved, err = checkImports(outdir, nil, deps)
+	require.NoError(t, err)
+	require.Len(t, unresolved, 3)
+}
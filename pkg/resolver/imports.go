@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/protoimport"
+)
+
+// resolveImports returns entries together with every file under protoRootDir they import,
+// transitively. Imports outside protoRootDir, such as other dependencies or well-known types,
+// are left to the import check. The result is sorted by source path.
+func resolveImports(protoRootDir string, entries []protoResource, isIgnored func(path string) bool) ([]protoResource, error) {
+	visited := make(map[string]bool)
+	resolved := make([]protoResource, 0, len(entries))
+
+	queue := append([]protoResource{}, entries...)
+	for _, entry := range entries {
+		visited[entry.source] = true
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		resolved = append(resolved, current)
+
+		content, err := os.ReadFile(current.source)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, imp := range protoimport.Parse(content) {
+			path := filepath.Join(protoRootDir, filepath.FromSlash(imp.Path))
+			if visited[path] {
+				continue
+			}
+			visited[path] = true
+
+			if stat, err := os.Stat(path); err != nil || stat.IsDir() {
+				continue
+			}
+			if isIgnored(path) {
+				logger.Event(logger.EventFileSkipped, logger.Fields{"file": path, "reason": "ignore", "imported_by": current.source}, "skipped %s imported by %s due to ignore setting", path, current.source)
+				continue
+			}
+
+			queue = append(queue, protoResource{
+				source:       path,
+				relativeDest: strings.Replace(path, protoRootDir, "", -1),
+			})
+		}
+	}
+
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].source < resolved[j].source
+	})
+
+	return resolved, nil
+}
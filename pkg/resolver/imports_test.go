@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func TestResolveImports(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/a/service.proto": `syntax = "proto3";
+import "a/model.proto";
+import "google/protobuf/empty.proto";
+`,
+		"proto/a/model.proto": `syntax = "proto3";
+import public "b/common.proto";
+import "b/ignored.proto";
+`,
+		"proto/b/common.proto":  `syntax = "proto3";`,
+		"proto/b/ignored.proto": `syntax = "proto3";`,
+		"proto/c/unused.proto":  `syntax = "proto3";`,
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  includes = ["/a/service.proto"]
+  ignores = ["**/ignored.proto"]
+  resolve_imports = true
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.True(t, lock.Dependencies[0].ResolveImports)
+
+	paths := make([]string, 0)
+	for _, file := range lock.Dependencies[0].Files {
+		paths = append(paths, file.Path)
+	}
+	require.Equal(t, []string{"a/model.proto", "a/service.proto", "b/common.proto"}, paths)
+
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto/b/ignored.proto")))
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto/c/unused.proto")))
+}
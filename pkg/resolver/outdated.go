@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/repository"
+)
+
+// OutdatedDependency compares a dependency locked in protodep.lock with its upstream.
+type OutdatedDependency struct {
+	Target string
+	// Revision is the commit hash recorded in protodep.lock.
+	Revision string
+	// Branch is the tracked branch and BranchHead the commit at its head.
+	Branch     string
+	BranchHead string
+	// LatestTag is the newest semver tag and LatestTagHash the commit it points to.
+	LatestTag     string
+	LatestTagHash string
+	// Behind reports whether upstream has commits newer than Revision.
+	Behind bool
+}
+
+// Outdated fetches every dependency in protodep.lock and compares the locked revision
+// with the upstream branch head and the newest semver tag. Dependencies locked to a tag
+// are compared with the newest tag, those with a version constraint with the highest tag
+// it allows, and the others, revisions included, with the head of their branch or of the
+// default branch. Nothing is checked out.
+func (s *resolver) Outdated(ctx context.Context) ([]OutdatedDependency, error) {
+	lock, err := config.NewDependency(s.conf.TargetDir, false).LoadLock()
+	if err != nil {
+		return nil, err
+	}
+
+	protodepDir := filepath.Join(s.conf.HomeDir, ".protodep")
+
+	result := make([]OutdatedDependency, 0, len(lock.Dependencies))
+	for _, dep := range lock.Dependencies {
+		if dep.SourceKind() != config.SourceGit {
+			logger.Info("skipped %s, only git sources have upstream revisions", dep.Target)
+			continue
+		}
+
+		gitrepo, err := s.newGit(dep, protodepDir)
+		if err != nil {
+			return nil, err
+		}
+
+		var upstream *repository.Upstream
+		err = s.fetch(ctx, dep, func(ctx context.Context) error {
+			upstream, err = gitrepo.Upstream(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", dep.Target, err)
+		}
+
+		// Dependencies pinned to a tag or a version follow tags, the others a branch.
+		compareTo := upstream.BranchHead
+		if (dep.Tag != "" || dep.Version != "") && upstream.LatestTagHash != "" {
+			compareTo = upstream.LatestTagHash
+		}
+
+		behind, err := isBehind(upstream.Repository, dep.Revision, compareTo)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", dep.Target, err)
+		}
+
+		result = append(result, OutdatedDependency{
+			Target:        dep.Target,
+			Revision:      dep.Revision,
+			Branch:        upstream.Branch,
+			BranchHead:    upstream.BranchHead,
+			LatestTag:     upstream.LatestTag,
+			LatestTagHash: upstream.LatestTagHash,
+			Behind:        behind,
+		})
+	}
+
+	return result, nil
+}
+
+// isBehind reports whether upstream is a descendant of the locked revision. The cache
+// only has the tips of shallow clones, so a locked revision that is not there, or whose
+// history to upstream is not there, is reported as behind as well.
+func isBehind(rep *git.Repository, locked string, upstream string) (bool, error) {
+	if locked == upstream {
+		return false, nil
+	}
+
+	upstreamCommit, err := rep.CommitObject(plumbing.NewHash(upstream))
+	if err != nil {
+		return false, fmt.Errorf("get commit %s: %w", upstream, err)
+	}
+
+	lockedCommit, err := rep.CommitObject(plumbing.NewHash(locked))
+	if err == plumbing.ErrObjectNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get commit %s: %w", locked, err)
+	}
+
+	behind, err := lockedCommit.IsAncestor(upstreamCommit)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return true, nil
+	}
+	return behind, err
+}
@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutdated(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3";`,
+	})
+	first := headOf(t, upstreamRepo)
+	tagTestRepository(t, upstreamRepo, "v1.0.0", first)
+
+	targetDir := t.TempDir()
+	homeDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  revision = "v1.0.0"
+  path = "tagged"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  path = "default"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  version = "~1.0.0"
+  path = "ranged"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   homeDir,
+		TargetDir: targetDir,
+		OutputDir: t.TempDir(),
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	deps, err := target.Outdated(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deps, 4)
+	for _, dep := range deps {
+		require.False(t, dep.Behind, dep.Target)
+		require.Equal(t, first.String(), dep.Revision)
+		require.Equal(t, "v1.0.0", dep.LatestTag)
+	}
+
+	second := commitTestFiles(t, upstreamRepo, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; package service;`,
+	})
+
+	// The branch moved, but there is no new tag yet.
+	deps, err = target.Outdated(context.Background())
+	require.NoError(t, err)
+	require.True(t, deps[0].Behind)
+	require.Equal(t, "master", deps[0].Branch)
+	require.Equal(t, second.String(), deps[0].BranchHead)
+	require.False(t, deps[1].Behind)
+	// Without a branch, the default branch is followed, not the newest tag.
+	require.True(t, deps[2].Behind)
+	require.Equal(t, second.String(), deps[2].BranchHead)
+
+	tagTestRepository(t, upstreamRepo, "v1.1.0", second)
+
+	deps, err = target.Outdated(context.Background())
+	require.NoError(t, err)
+	require.True(t, deps[0].Behind)
+	require.True(t, deps[1].Behind)
+	require.Equal(t, "v1.1.0", deps[1].LatestTag)
+	require.Equal(t, second.String(), deps[1].LatestTagHash)
+	// v1.1.0 is outside of ~1.0.0.
+	require.False(t, deps[3].Behind)
+	require.Equal(t, "v1.0.0", deps[3].LatestTag)
+
+	// Only the tips were fetched, the clone is still shallow.
+	cache, err := git.PlainOpen(filepath.Join(homeDir, ".protodep", "github.com", "stormcat24", "upstream"))
+	require.NoError(t, err)
+	shallows, err := cache.Storer.Shallow()
+	require.NoError(t, err)
+	require.NotEmpty(t, shallows)
+}
@@ -0,0 +1,151 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+// FileChangeKind describes what up would do to a vendored file.
+type FileChangeKind string
+
+const (
+	FileAdded    FileChangeKind = "added"
+	FileModified FileChangeKind = "modified"
+	FileRemoved  FileChangeKind = "removed"
+)
+
+// FileChange is a file under proto_outdir that up would write or remove.
+type FileChange struct {
+	Kind FileChangeKind
+	// Path is relative to proto_outdir and uses forward slashes.
+	Path string
+}
+
+// PlannedDependency is a dependency as up would resolve it.
+type PlannedDependency struct {
+	Target string
+	Path   string
+	// New is true when the dependency is not in protodep.lock yet.
+	New bool
+	// LockedRevision is the revision in protodep.lock. Local sources have no revision.
+	LockedRevision string
+	Revision       string
+	Changes        []FileChange
+}
+
+// Plan describes what up would change, without changing it.
+type Plan struct {
+	Dependencies []PlannedDependency
+	// Removed are the files of dependencies that are no longer resolved.
+	Removed []FileChange
+	// LockDiff is a unified diff of protodep.lock, empty when it would not change.
+	LockDiff string
+}
+
+// Plan resolves the dependencies like Resolve, but only updates the cache and reports the
+// changes to proto_outdir and protodep.lock instead of making them.
+func (s *resolver) Plan(ctx context.Context, opts Options) (*Plan, error) {
+	_, plan, err := s.resolve(ctx, opts, true)
+	return plan, err
+}
+
+// newPlan compares the resolved deps with the files under outdir and with lock. lockPath
+// is the protodep.lock that would be written with newLock, empty when it would not be.
+func newPlan(outdir string, lock *config.ProtoDep, deps []config.ProtoDepDependency, lockPath string, newLock *config.ProtoDep) (*Plan, error) {
+	locked := lockedDependencies(lock)
+	plan := &Plan{}
+
+	current := make(map[string]bool)
+	resolved := make(map[string]bool)
+	for _, dep := range deps {
+		resolved[lockKey(dep)] = true
+		for _, file := range vendoredFiles(dep, locked) {
+			current[file.Path] = true
+		}
+	}
+
+	for _, dep := range deps {
+		planned := PlannedDependency{
+			Target:   dep.Target,
+			Path:     dep.Path,
+			New:      true,
+			Revision: pinnedRevision(&dep),
+		}
+
+		for _, file := range dep.Files {
+			content, err := os.ReadFile(filepath.Join(outdir, filepath.FromSlash(file.Path)))
+			switch {
+			case os.IsNotExist(err):
+				planned.Changes = append(planned.Changes, FileChange{Kind: FileAdded, Path: file.Path})
+			case err != nil:
+				return nil, err
+			case fileDigest(content) != file.Hash:
+				planned.Changes = append(planned.Changes, FileChange{Kind: FileModified, Path: file.Path})
+			}
+		}
+
+		if l, ok := locked[lockKey(dep)]; ok {
+			planned.New = false
+			planned.LockedRevision = pinnedRevision(l)
+			for _, file := range l.Files {
+				if !current[file.Path] {
+					planned.Changes = append(planned.Changes, FileChange{Kind: FileRemoved, Path: file.Path})
+				}
+			}
+		}
+
+		plan.Dependencies = append(plan.Dependencies, planned)
+	}
+
+	if lock != nil {
+		for _, dep := range lock.Dependencies {
+			if resolved[lockKey(dep)] {
+				continue
+			}
+			for _, file := range dep.Files {
+				if !current[file.Path] {
+					plan.Removed = append(plan.Removed, FileChange{Kind: FileRemoved, Path: file.Path})
+				}
+			}
+		}
+	}
+
+	if lockPath != "" {
+		diff, err := lockDiff(lockPath, newLock)
+		if err != nil {
+			return nil, err
+		}
+		plan.LockDiff = diff
+	}
+
+	return plan, nil
+}
+
+// lockDiff returns a unified diff from the protodep.lock at lockPath to newLock.
+func lockDiff(lockPath string, newLock *config.ProtoDep) (string, error) {
+	before, err := os.ReadFile(lockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var after bytes.Buffer
+	if err := toml.NewEncoder(&after).Encode(newLock); err != nil {
+		return "", fmt.Errorf("encode config to toml format: %w", err)
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(after.String()),
+		FromFile: "protodep.lock",
+		ToFile:   "protodep.lock",
+		Context:  3,
+	})
+}
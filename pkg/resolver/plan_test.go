@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v1`,
+		"proto/legacy.proto":  `syntax = "proto3";`,
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	before := headOf(t, upstreamRepo).String()
+	lockBefore := readTestFile(t, filepath.Join(targetDir, "protodep.lock"))
+
+	plan, err := target.Plan(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Len(t, plan.Dependencies, 1)
+	require.Equal(t, before, plan.Dependencies[0].Revision)
+	require.Equal(t, before, plan.Dependencies[0].LockedRevision)
+	require.Empty(t, plan.Dependencies[0].Changes)
+	require.Empty(t, plan.LockDiff)
+
+	repo, err := git.PlainOpen(upstreamRepo)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Remove("proto/legacy.proto")
+	require.NoError(t, err)
+	after := commitTestFiles(t, upstreamRepo, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v2`,
+		"proto/model.proto":   `syntax = "proto3";`,
+	}).String()
+
+	plan, err = target.Plan(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Equal(t, PlannedDependency{
+		Target:         "github.com/stormcat24/upstream/proto",
+		LockedRevision: before,
+		Revision:       after,
+		Changes: []FileChange{
+			{Kind: FileAdded, Path: "model.proto"},
+			{Kind: FileModified, Path: "service.proto"},
+			{Kind: FileRemoved, Path: "legacy.proto"},
+		},
+	}, plan.Dependencies[0])
+	require.Contains(t, plan.LockDiff, "-  revision = \""+before+"\"")
+	require.Contains(t, plan.LockDiff, "+  revision = \""+after+"\"")
+
+	// Nothing was written.
+	require.Equal(t, lockBefore, readTestFile(t, filepath.Join(targetDir, "protodep.lock")))
+	require.Equal(t, `syntax = "proto3"; // v1`, readTestFile(t, filepath.Join(outputDir, "proto", "service.proto")))
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto", "legacy.proto")))
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto", "model.proto")))
+}
@@ -2,12 +2,17 @@ package resolver
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
-	"github.com/BurntSushi/toml"
 	"github.com/gobwas/glob"
 	"github.com/stormcat24/protodep/pkg/auth"
 	"github.com/stormcat24/protodep/pkg/config"
@@ -21,12 +26,90 @@ type protoResource struct {
 }
 
 type Resolver interface {
-	Resolve(forceUpdate bool, cleanupCache bool) error
+	Resolve(ctx context.Context, opts Options) (*Result, error)
+	Plan(ctx context.Context, opts Options) (*Plan, error)
+	Outdated(ctx context.Context) ([]OutdatedDependency, error)
+	Verify() ([]Drift, error)
+	DefaultBranch(ctx context.Context, dep config.ProtoDepDependency) (string, error)
 
 	SetHttpsAuthProvider(provider auth.AuthProvider)
 	SetSshAuthProvider(provider auth.AuthProvider)
 }
 
+// Result describes what Resolve vendored.
+type Result struct {
+	// ProtoOutdir is the directory the files were vendored into.
+	ProtoOutdir string
+	// Dependencies are the resolved dependencies, in the order of protodep.lock.
+	Dependencies []config.ProtoDepDependency
+	// WrittenFiles are the files that were created or changed, and RemovedFiles those
+	// that are no longer vendored. Paths are relative to ProtoOutdir and use forward
+	// slashes.
+	WrittenFiles []string
+	RemovedFiles []string
+	// Lock is the content of protodep.lock. LockFile is its path, empty when protodep.lock
+	// was not written because it was already up to date.
+	Lock     *config.ProtoDep
+	LockFile string
+	// CacheSize is the size in bytes of the clones and downloads under {home}/.protodep.
+	CacheSize int64
+}
+
+// DependencyError is the failure to resolve one dependency.
+type DependencyError struct {
+	Target string
+	Path   string
+	Err    error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Target, e.Err)
+}
+
+func (e *DependencyError) Unwrap() error {
+	return e.Err
+}
+
+// DependenciesError lists every dependency that failed when Options.KeepGoing is set.
+type DependenciesError struct {
+	// Errors are in the order of protodep.toml, after the transitive dependencies that
+	// could not be walked.
+	Errors []*DependencyError
+	// Total is the number of dependencies that were attempted, including the failed ones.
+	Total int
+}
+
+func (e *DependenciesError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("%d of %d dependencies failed:", len(e.Errors), e.Total))
+	for _, err := range e.Errors {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// join adds the failures in err, from resolving the dependencies found despite e, to e.
+func (e *DependenciesError) join(err error) error {
+	var resolveErr *DependenciesError
+	if err != nil && !errors.As(err, &resolveErr) {
+		return err
+	}
+
+	joined := &DependenciesError{Errors: e.Errors, Total: e.Total}
+	if resolveErr != nil {
+		joined.Errors = append(append([]*DependencyError{}, e.Errors...), resolveErr.Errors...)
+	}
+	return joined
+}
+
+func (e *DependenciesError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
 type resolver struct {
 	conf *Config
 
@@ -34,7 +117,30 @@ type resolver struct {
 	sshProvider   auth.AuthProvider
 }
 
+// run is the state of one Resolve or Plan call, shared by the jobs resolving dependencies.
+type run struct {
+	ctx         context.Context
+	protodepDir string
+	outdir      string
+	targets     []string
+	dryRun      bool
+	keepGoing   bool
+
+	mu      sync.Mutex
+	written []string
+}
+
+func (r *run) addWritten(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written = append(r.written, path)
+}
+
 func New(conf *Config) (Resolver, error) {
+	if conf.TargetDir == "" {
+		return nil, errors.New("TargetDir is required")
+	}
+
 	s := &resolver{
 		conf: conf,
 	}
@@ -47,130 +153,738 @@ func New(conf *Config) (Resolver, error) {
 	return s, nil
 }
 
-func (s *resolver) Resolve(forceUpdate bool, cleanupCache bool) error {
+// Resolve vendors the dependencies of protodep.toml into proto_outdir and writes
+// protodep.lock. ctx cancels the dependencies that are not resolved yet.
+func (s *resolver) Resolve(ctx context.Context, opts Options) (*Result, error) {
+	result, _, err := s.resolve(ctx, opts, false)
+	return result, err
+}
+
+// resolve vendors the dependencies. With dryRun, nothing but the cache is written and the
+// changes that would be made are returned instead.
+func (s *resolver) resolve(ctx context.Context, opts Options, dryRun bool) (*Result, *Plan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if s.conf.HomeDir == "" {
+		return nil, nil, errors.New("HomeDir is required to cache dependencies")
+	}
+
+	// Updating some targets reads protodep.toml, like a force update.
+	forceUpdate := opts.ForceUpdate || len(opts.Targets) > 0
 
 	dep := config.NewDependency(s.conf.TargetDir, forceUpdate)
 	protodep, err := dep.Load()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	newdeps := make([]config.ProtoDepDependency, 0, len(protodep.Dependencies))
 	protodepDir := filepath.Join(s.conf.HomeDir, ".protodep")
 
+	if opts.CleanupCache && s.conf.Offline {
+		return nil, nil, errors.New("cleanup cache is not allowed in offline mode")
+	}
+	if opts.CleanupCache && dryRun {
+		return nil, nil, errors.New("cleanup cache is not allowed in dry run mode")
+	}
+
 	_, err = os.Stat(protodepDir)
-	if cleanupCache && err == nil {
+	if opts.CleanupCache && err == nil {
 		files, err := os.ReadDir(protodepDir)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		for _, file := range files {
 			if file.IsDir() {
 				dirpath := filepath.Join(protodepDir, file.Name())
 				if err := os.RemoveAll(dirpath); err != nil {
-					return err
+					return nil, nil, err
 				}
 			}
 		}
 	}
 
-	outdir := filepath.Join(s.conf.OutputDir, protodep.ProtoOutdir)
-	if err := os.RemoveAll(outdir); err != nil {
-		return err
+	// The previous lock is used to detect upstream content changes for the same revision.
+	lock := protodep
+	if dep.IsNeedWriteLockFile() {
+		lock = nil
+		if dep.HasLockFile() {
+			lock, err = dep.LoadLock()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
-	for _, dep := range protodep.Dependencies {
-		var authProvider auth.AuthProvider
+	// protodep.lock of an older version is rewritten once with the digests of its files,
+	// keeping its revisions.
+	writesLock := dep.IsNeedWriteLockFile() || missesDigests(protodep)
+
+	outdir := filepath.Join(s.conf.outputDir(), protodep.ProtoOutdir)
+
+	deps := protodep.Dependencies
+	// With KeepGoing, the dependencies found despite failures in the graph are resolved too.
+	var graphErr *DependenciesError
+	// protodep.lock already contains the transitive dependencies.
+	if protodep.Transitive && dep.IsNeedWriteLockFile() {
+		deps, err = s.expandTransitive(ctx, protodep, protodepDir, opts.KeepGoing)
+		if err != nil && !errors.As(err, &graphErr) {
+			return nil, nil, err
+		}
+	}
 
-		if s.conf.UseHttps {
-			authProvider = s.httpsProvider
+	// protodep.lock written by older versions does not list the files protodep owns.
+	owned, err := claimUnlistedFiles(outdir, lock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &run{
+		ctx:         ctx,
+		protodepDir: protodepDir,
+		outdir:      outdir,
+		targets:     opts.Targets,
+		dryRun:      dryRun,
+		keepGoing:   opts.KeepGoing,
+	}
+
+	// Files are vendored into a copy of proto_outdir, which replaces it only once every
+	// dependency is resolved.
+	var st *stage
+	if !dryRun {
+		if isWithin(s.conf.TargetDir, outdir) {
+			// proto_outdir contains protodep.toml and cannot be swapped.
+			logger.Warn("%s contains %s, files are vendored in place", outdir, s.conf.TargetDir)
 		} else {
-			switch dep.Protocol {
-			case "https":
-				authProvider = s.httpsProvider
-			case "ssh", "":
-				authProvider = s.sshProvider
-			default:
-				return fmt.Errorf("%s protocol is not accepted (ssh or https only)", dep.Protocol)
+			st, err = newStage(outdir)
+			if err != nil {
+				return nil, nil, err
 			}
+			defer st.discard()
+			r.outdir = st.dir
+		}
+	}
+
+	var newdeps []config.ProtoDepDependency
+	if len(opts.Targets) > 0 {
+		newdeps, err = s.resolveTargets(r, deps, lock)
+	} else {
+		newdeps, err = s.resolveDependencies(r, deps, lock)
+	}
+	if graphErr != nil {
+		err = graphErr.join(err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cacheSize, err := dirSize(protodepDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("measure cache: %w", err)
+	}
+	logger.Info("cache %s takes %s", protodepDir, formatSize(cacheSize))
+
+	newProtodep := config.ProtoDep{
+		ProtoOutdir:      protodep.ProtoOutdir,
+		Transitive:       protodep.Transitive,
+		ConflictStrategy: protodep.ConflictStrategy,
+		ImportPaths:      protodep.ImportPaths,
+		Dependencies:     newdeps,
+	}
+
+	lockPath := filepath.Join(s.conf.TargetDir, "protodep.lock")
+	if dryRun {
+		if !writesLock {
+			lockPath = ""
 		}
+		plan, err := newPlan(outdir, owned, newdeps, lockPath, &newProtodep)
+		return nil, plan, err
+	}
 
-		gitrepo := repository.NewGit(protodepDir, dep, authProvider)
+	removed, err := removeStaleFiles(r.outdir, owned, newdeps)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		repo, err := gitrepo.Open()
-		if err != nil {
+	importPaths := make([]string, 0, len(protodep.ImportPaths))
+	for _, path := range protodep.ImportPaths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.conf.TargetDir, path)
+		}
+		importPaths = append(importPaths, path)
+	}
+
+	unresolved, err := checkImports(r.outdir, importPaths, newdeps)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, u := range unresolved {
+		logger.Warn("%s", u)
+	}
+	if len(unresolved) > 0 && s.conf.StrictImports {
+		return nil, nil, fmt.Errorf("%d imports of vendored files do not resolve", len(unresolved))
+	}
+
+	result := &Result{
+		ProtoOutdir:  outdir,
+		Dependencies: newdeps,
+		WrittenFiles: r.written,
+		RemovedFiles: removed,
+		Lock:         &newProtodep,
+		CacheSize:    cacheSize,
+	}
+	sort.Strings(result.WrittenFiles)
+
+	writeLock := func() error {
+		if !writesLock {
+			return nil
+		}
+		if err := config.Write(lockPath, &newProtodep); err != nil {
 			return err
 		}
+		result.LockFile = lockPath
+		return nil
+	}
+
+	if st != nil {
+		err = st.commit(writeLock)
+	} else {
+		err = writeLock()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, nil, nil
+}
+
+// resolveDependencies resolves deps with up to conf.Jobs workers. The result
+// keeps the order of deps regardless of which job finishes first.
+func (s *resolver) resolveDependencies(r *run, deps []config.ProtoDepDependency, lock *config.ProtoDep) ([]config.ProtoDepDependency, error) {
+	jobs := s.conf.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(deps) {
+		jobs = len(deps)
+	}
+	if jobs > 1 {
+		defer logger.Concurrent()()
+	}
+
+	// Dependencies sharing a repository are checked out in the same clone
+	// under .protodep, so they must not be resolved at the same time.
+	repoLocks := make(map[string]*sync.Mutex)
+	for _, dep := range deps {
+		if _, ok := repoLocks[sourceKey(dep)]; !ok {
+			repoLocks[sourceKey(dep)] = &sync.Mutex{}
+		}
+	}
+
+	locked := lockedDependencies(lock)
 
-		sources := make([]protoResource, 0)
+	newdeps := make([]config.ProtoDepDependency, len(deps))
+	errs := make([]error, len(deps))
 
-		compiledIgnores := compileIgnoreToGlob(dep.Ignores)
-		compiledIncludes := compileIgnoreToGlob(dep.Includes)
+	var failed atomic.Bool
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				// Do not start new work once a dependency has failed or the run is canceled.
+				if failed.Load() {
+					continue
+				}
+				if err := r.ctx.Err(); err != nil {
+					errs[idx] = err
+					continue
+				}
 
-		hasIncludes := len(dep.Includes) > 0
+				dep := deps[idx]
+				lock := repoLocks[sourceKey(dep)]
 
-		protoRootDir := gitrepo.ProtoRootDir()
-		filepath.Walk(protoRootDir, func(path string, info os.FileInfo, err error) error {
+				lock.Lock()
+				newdep, err := s.resolveDependency(r, dep, locked[lockKey(dep)])
+				lock.Unlock()
+
+				if err != nil {
+					errs[idx] = err
+					// Keep going to report every dependency missing from the cache at once.
+					if !r.keepGoing && !errors.Is(err, repository.ErrNotCached) {
+						failed.Store(true)
+					}
+					continue
+				}
+				newdeps[idx] = *newdep
+			}
+		}()
+	}
+
+	for idx := range deps {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+
+	if r.keepGoing {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		failures := make([]*DependencyError, 0)
+		for idx, err := range errs {
 			if err != nil {
-				return err
+				failures = append(failures, &DependencyError{Target: deps[idx].Target, Path: deps[idx].Path, Err: err})
 			}
-			if strings.HasSuffix(path, ".proto") {
-				isIncludePath := s.isMatchPath(protoRootDir, path, dep.Includes, compiledIncludes)
-				isIgnorePath := s.isMatchPath(protoRootDir, path, dep.Ignores, compiledIgnores)
-
-				if hasIncludes && !isIncludePath {
-					logger.Info("skipped %s due to include setting", path)
-				} else if isIgnorePath {
-					logger.Info("skipped %s due to ignore setting", path)
-				} else {
-					sources = append(sources, protoResource{
-						source:       path,
-						relativeDest: strings.Replace(path, protoRootDir, "", -1),
-					})
-				}
+		}
+		if len(failures) > 0 {
+			return nil, &DependenciesError{Errors: failures, Total: len(deps)}
+		}
+		return newdeps, nil
+	}
+
+	missing := make([]error, 0)
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, repository.ErrNotCached) {
+			return nil, err
+		}
+		missing = append(missing, err)
+	}
+
+	if len(missing) > 0 {
+		header := fmt.Errorf("%d dependencies are not available offline:", len(missing))
+		return nil, errors.Join(append([]error{header}, missing...)...)
+	}
+
+	return newdeps, nil
+}
+
+// resolveDependency checks out dep and copies its files into outdir. locked is the entry
+// of protodep.lock for the same dependency, or nil.
+func (s *resolver) resolveDependency(r *run, dep config.ProtoDepDependency, locked *config.ProtoDepDependency) (*config.ProtoDepDependency, error) {
+	fields := logger.Fields{"target": dep.Target, "path": dep.Path}
+	logger.Event(logger.EventDependencyStarted, fields, "resolving %s", dep.Target)
+
+	newdep, err := s.vendorDependency(r, dep, locked)
+	if err != nil {
+		logger.Event(logger.EventError, logger.Fields{"target": dep.Target, "path": dep.Path, "error": err.Error()}, "failed to resolve %s: %v", dep.Target, err)
+		return nil, logger.Reported(err)
+	}
+
+	logger.Event(logger.EventDependencyFinished, fields, "resolved %s", dep.Target)
+	return newdep, nil
+}
+
+func (s *resolver) vendorDependency(r *run, dep config.ProtoDepDependency, locked *config.ProtoDepDependency) (*config.ProtoDepDependency, error) {
+	compiledIgnores, err := compileIgnoreToGlob(dep.Ignores)
+	if err != nil {
+		return nil, err
+	}
+	compiledIncludes, err := compileIgnoreToGlob(dep.Includes)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := s.newSource(dep, r.protodepDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo *repository.OpenedRepository
+	err = s.fetch(r.ctx, dep, func(ctx context.Context) error {
+		repo, err = source.Open(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Event(logger.EventDependencyFetched, logger.Fields{"target": dep.Target, "path": dep.Path, "source": dep.SourceKind()}, "fetched %s", dep.Target)
+	// Local sources have no revision.
+	if repo.Hash != "" {
+		logger.Event(logger.EventRevisionResolved, logger.Fields{"target": dep.Target, "path": dep.Path, "revision": repo.Hash, "tag": repo.Tag}, "%s is at %s", dep.Target, repo.Hash)
+	}
+
+	sources := make([]protoResource, 0)
+
+	hasIncludes := len(dep.Includes) > 0
+
+	protoRootDir := source.ProtoRootDir()
+	filepath.Walk(protoRootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".proto") {
+			isIncludePath := s.isMatchPath(protoRootDir, path, dep.Includes, compiledIncludes)
+			isIgnorePath := s.isMatchPath(protoRootDir, path, dep.Ignores, compiledIgnores)
+
+			if hasIncludes && !isIncludePath {
+				logger.Event(logger.EventFileSkipped, logger.Fields{"target": dep.Target, "file": path, "reason": "include"}, "skipped %s due to include setting", path)
+			} else if isIgnorePath {
+				logger.Event(logger.EventFileSkipped, logger.Fields{"target": dep.Target, "file": path, "reason": "ignore"}, "skipped %s due to ignore setting", path)
+			} else {
+				sources = append(sources, protoResource{
+					source:       path,
+					relativeDest: strings.Replace(path, protoRootDir, "", -1),
+				})
 			}
-			return nil
+		}
+		return nil
+	})
+
+	if dep.ResolveImports {
+		sources, err = resolveImports(protoRootDir, sources, func(path string) bool {
+			return s.isMatchPath(protoRootDir, path, dep.Ignores, compiledIgnores)
 		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := make([]config.ProtoDepFile, 0, len(sources))
+	contents := make([][]byte, 0, len(sources))
+	for _, s := range sources {
+		content, err := os.ReadFile(s.source)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, config.ProtoDepFile{
+			Path: strings.TrimPrefix(filepath.ToSlash(filepath.Join(dep.Path, s.relativeDest)), "/"),
+			Hash: fileDigest(content),
+		})
+		contents = append(contents, content)
+	}
+
+	newdep := &config.ProtoDepDependency{
+		Target:         repo.Dep.Target,
+		Branch:         repo.Dep.Branch,
+		Revision:       repo.Hash,
+		Path:           repo.Dep.Path,
+		Includes:       repo.Dep.Includes,
+		Ignores:        repo.Dep.Ignores,
+		Protocol:       repo.Dep.Protocol,
+		Subgroup:       repo.Dep.Subgroup,
+		Source:         repo.Dep.Source,
+		URL:            repo.Dep.URL,
+		SHA256:         repo.Dep.SHA256,
+		Subdir:         repo.Dep.Subdir,
+		Digest:         repo.Dep.Digest,
+		Version:        repo.Dep.Version,
+		ResolveImports: repo.Dep.ResolveImports,
+		Tag:            repo.Tag,
+		Via:            repo.Dep.Via,
+		TreeHash:       treeDigest(files),
+		Files:          files,
+	}
+
+	if err := checkIntegrity(locked, newdep); err != nil {
+		return nil, err
+	}
+
+	if r.dryRun {
+		return newdep, nil
+	}
 
-		for _, s := range sources {
-			outpath := filepath.Join(outdir, dep.Path, s.relativeDest)
+	paths := make([]string, 0, len(files))
+	for i, file := range files {
+		outpath := filepath.Join(r.outdir, filepath.FromSlash(file.Path))
+		written, err := writeFileIfChanged(outpath, contents[i])
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			r.addWritten(file.Path)
+		}
+		logger.Trace("copied %s", file.Path)
+		paths = append(paths, file.Path)
+	}
+	logger.Event(logger.EventFilesCopied, logger.Fields{"target": dep.Target, "path": dep.Path, "files": paths}, "copied %d files of %s", len(paths), dep.Target)
 
-			content, err := os.ReadFile(s.source)
+	return newdep, nil
+}
+
+// Key names dep in Options.Targets by its target and path, without the other entries that
+// vendor the same target.
+func Key(dep config.ProtoDepDependency) string {
+	return lockKey(dep)
+}
+
+// lockKey identifies a dependency in protodep.lock. The same target may be vendored
+// into several paths.
+func lockKey(dep config.ProtoDepDependency) string {
+	return dep.Target + "@" + dep.Path
+}
+
+func lockedDependencies(lock *config.ProtoDep) map[string]*config.ProtoDepDependency {
+	locked := make(map[string]*config.ProtoDepDependency)
+	if lock == nil {
+		return locked
+	}
+	for i := range lock.Dependencies {
+		locked[lockKey(lock.Dependencies[i])] = &lock.Dependencies[i]
+	}
+	return locked
+}
+
+// resolveTargets resolves only the dependencies r.targets selects, and those missing
+// from lock. The other dependencies keep their entries in lock. Targets that are only
+// left in lock are dropped.
+func (s *resolver) resolveTargets(r *run, deps []config.ProtoDepDependency, lock *config.ProtoDep) ([]config.ProtoDepDependency, error) {
+	wanted := make(map[string]bool)
+	for _, target := range r.targets {
+		wanted[target] = true
+	}
+
+	// A target selects every entry with that target, a key only the entry with that path.
+	known := make(map[string]bool)
+	selects := func(dep config.ProtoDepDependency) bool {
+		for _, name := range []string{dep.Target, lockKey(dep)} {
+			if wanted[name] {
+				known[name] = true
+				return true
+			}
+		}
+		return false
+	}
+	if lock != nil {
+		for _, l := range lock.Dependencies {
+			selects(l)
+		}
+	}
+
+	locked := lockedDependencies(lock)
+	selected := make([]config.ProtoDepDependency, 0)
+	for _, dep := range deps {
+		if selects(dep) {
+			selected = append(selected, dep)
+		} else if _, ok := locked[lockKey(dep)]; !ok {
+			logger.Info("%s is not in protodep.lock, resolving it as well", dep.Target)
+			selected = append(selected, dep)
+		}
+	}
+
+	unknown := make([]string, 0)
+	for _, target := range r.targets {
+		if !known[target] {
+			unknown = append(unknown, target)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("not in protodep.toml: %s", strings.Join(unknown, ", "))
+	}
+
+	resolved, err := s.resolveDependencies(r, selected, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the order of protodep.toml, with the locked entries of the other dependencies.
+	newdeps := make([]config.ProtoDepDependency, 0, len(deps))
+	for _, dep := range deps {
+		if l, ok := locked[lockKey(dep)]; ok && !selects(dep) {
+			newdeps = append(newdeps, *l)
+			continue
+		}
+		newdeps = append(newdeps, resolved[0])
+		resolved = resolved[1:]
+	}
+
+	return newdeps, nil
+}
+
+// missesDigests reports whether a dependency of lock has no recorded digests, because an
+// older version or import buf wrote it.
+func missesDigests(lock *config.ProtoDep) bool {
+	for _, dep := range lock.Dependencies {
+		if dep.TreeHash == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// claimUnlistedFiles returns lock with the files of the dependencies that do not list them,
+// because an older version locked them. Those are taken to own the .proto files under their
+// path in outdir, the only files protodep vendors. Other files are left alone. Versions
+// that did not list files only had git sources, so other sources without a list, like the
+// pins written by import buf, have vendored nothing yet.
+func claimUnlistedFiles(outdir string, lock *config.ProtoDep) (*config.ProtoDep, error) {
+	if lock == nil {
+		return nil, nil
+	}
+
+	owned := *lock
+	owned.Dependencies = make([]config.ProtoDepDependency, len(lock.Dependencies))
+	for i, dep := range lock.Dependencies {
+		owned.Dependencies[i] = dep
+		if dep.TreeHash != "" || dep.SourceKind() != config.SourceGit {
+			continue
+		}
+
+		root := filepath.Join(outdir, filepath.FromSlash(dep.Path))
+		logger.Info("protodep.lock does not list the files of %s, taking the .proto files under %s as its own", dep.Target, root)
+		files := make([]config.ProtoDepFile, 0)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
 				return err
 			}
-
-			if err := writeFileWithDirectory(outpath, content, 0644); err != nil {
+			if d.IsDir() || filepath.Ext(path) != ".proto" {
+				return nil
+			}
+			relpath, err := filepath.Rel(outdir, path)
+			if err != nil {
 				return err
 			}
+			files = append(files, config.ProtoDepFile{Path: filepath.ToSlash(relpath)})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk %s: %w", root, err)
 		}
+		owned.Dependencies[i].Files = files
+	}
+	return &owned, nil
+}
 
-		newdeps = append(newdeps, config.ProtoDepDependency{
-			Target:   repo.Dep.Target,
-			Branch:   repo.Dep.Branch,
-			Revision: repo.Hash,
-			Path:     repo.Dep.Path,
-			Includes: repo.Dep.Includes,
-			Ignores:  repo.Dep.Ignores,
-			Protocol: repo.Dep.Protocol,
-			Subgroup: repo.Dep.Subgroup,
-		})
+// vendoredFiles returns the files dep vendors. The dependencies kept from protodep.lock
+// without a file list own the files claimUnlistedFiles found for them in owned.
+func vendoredFiles(dep config.ProtoDepDependency, owned map[string]*config.ProtoDepDependency) []config.ProtoDepFile {
+	if dep.TreeHash == "" {
+		if l, ok := owned[lockKey(dep)]; ok {
+			return l.Files
+		}
 	}
+	return dep.Files
+}
 
-	newProtodep := config.ProtoDep{
-		ProtoOutdir:  protodep.ProtoOutdir,
-		Dependencies: newdeps,
+// removeStaleFiles removes the files lock lists that none of deps vendors anymore, and
+// returns them. Files protodep did not vendor are left alone.
+func removeStaleFiles(outdir string, lock *config.ProtoDep, deps []config.ProtoDepDependency) ([]string, error) {
+	if lock == nil {
+		return nil, nil
 	}
 
-	if dep.IsNeedWriteLockFile() {
-		if err := writeToml("protodep.lock", newProtodep); err != nil {
-			return err
+	owned := lockedDependencies(lock)
+	current := make(map[string]bool)
+	for _, dep := range deps {
+		for _, file := range vendoredFiles(dep, owned) {
+			current[file.Path] = true
 		}
 	}
 
+	stale := make([]string, 0)
+	for _, dep := range lock.Dependencies {
+		for _, file := range dep.Files {
+			if !current[file.Path] {
+				stale = append(stale, file.Path)
+			}
+		}
+	}
+
+	for _, path := range stale {
+		logger.Info("removed %s", path)
+	}
+	return stale, removeVendoredFiles(outdir, stale)
+}
+
+// removeVendoredFiles removes paths, relative to outdir, and the directories left empty.
+func removeVendoredFiles(outdir string, paths []string) error {
+	for _, p := range paths {
+		path := filepath.Join(outdir, filepath.FromSlash(p))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		for dir := filepath.Dir(path); dir != outdir && strings.HasPrefix(dir, outdir); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
 	return nil
 }
 
+// DefaultBranch asks the remote repository of dep for its default branch.
+func (s *resolver) DefaultBranch(ctx context.Context, dep config.ProtoDepDependency) (string, error) {
+	gitrepo, err := s.newGit(dep, filepath.Join(s.conf.HomeDir, ".protodep"))
+	if err != nil {
+		return "", err
+	}
+
+	var branch string
+	err = s.fetch(ctx, dep, func(ctx context.Context) error {
+		branch, err = gitrepo.DefaultBranch(ctx)
+		return err
+	})
+	return branch, err
+}
+
+// sourceKey identifies where a dependency is vendored from. Dependencies with the same key
+// share a clone or a directory.
+func sourceKey(dep config.ProtoDepDependency) string {
+	switch dep.SourceKind() {
+	case config.SourceArchive:
+		return dep.URL
+	case config.SourceLocal, config.SourceBSR:
+		return dep.Target
+	default:
+		return dep.Repository()
+	}
+}
+
+func (s *resolver) newSource(dep config.ProtoDepDependency, protodepDir string) (repository.Source, error) {
+	var authProvider auth.AuthProvider
+	if dep.SourceKind() == config.SourceGit {
+		provider, err := s.authProviderFor(dep)
+		if err != nil {
+			return nil, err
+		}
+		authProvider = provider
+	}
+
+	return repository.NewSource(protodepDir, dep, authProvider, s.sourceOptions()...)
+}
+
+func (s *resolver) newGit(dep config.ProtoDepDependency, protodepDir string) (repository.Git, error) {
+	authProvider, err := s.authProviderFor(dep)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.NewGit(protodepDir, dep, authProvider, s.sourceOptions()...), nil
+}
+
+func (s *resolver) sourceOptions() []repository.Option {
+	opts := []repository.Option{repository.WithBaseDir(s.conf.TargetDir)}
+	if s.conf.Offline {
+		opts = append(opts, repository.WithOffline())
+	}
+	return opts
+}
+
+func (s *resolver) authProviderFor(dep config.ProtoDepDependency) (auth.AuthProvider, error) {
+	if s.conf.UseHttps {
+		return s.httpsProvider, nil
+	}
+
+	switch dep.Protocol {
+	case "https":
+		return s.httpsProvider, nil
+	case "ssh", "":
+		return s.sshProvider, nil
+	default:
+		return nil, fmt.Errorf("%s protocol is not accepted (ssh or https only)", dep.Protocol)
+	}
+}
+
 func (s *resolver) SetHttpsAuthProvider(provider auth.AuthProvider) {
 	s.httpsProvider = provider
 }
@@ -204,14 +918,18 @@ func (s *resolver) initAuthProviders() error {
 	return nil
 }
 
-func compileIgnoreToGlob(ignores []string) []glob.Glob {
+func compileIgnoreToGlob(ignores []string) ([]glob.Glob, error) {
 	globIgnores := make([]glob.Glob, len(ignores))
 
 	for idx, ignore := range ignores {
-		globIgnores[idx] = glob.MustCompile(ignore)
+		g, err := glob.Compile(ignore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", ignore, err)
+		}
+		globIgnores[idx] = g
 	}
 
-	return globIgnores
+	return globIgnores, nil
 }
 
 func (s *resolver) isMatchPath(protoRootDir string, target string, paths []string, globMatch []glob.Glob) bool {
@@ -236,18 +954,49 @@ func (s *resolver) isMatchPath(protoRootDir string, target string, paths []strin
 	return false
 }
 
-func writeToml(dest string, input interface{}) error {
-	var buffer bytes.Buffer
-	encoder := toml.NewEncoder(&buffer)
-	if err := encoder.Encode(input); err != nil {
-		return fmt.Errorf("encode config to toml format: %w", err)
-	}
+// dirSize returns the total size of the files under dir, 0 when dir does not exist.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
 
-	if err := os.WriteFile(dest, buffer.Bytes(), 0644); err != nil {
-		return fmt.Errorf("write to %s: %w", dest, err)
+// formatSize formats size in bytes with a binary unit, such as 12.3 MiB.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
 	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
 
-	return nil
+// writeFileIfChanged writes data to path unless the file already has that content, so
+// unchanged files keep their modification time. It reports whether the file was written.
+func writeFileIfChanged(path string, data []byte) (bool, error) {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	return true, writeFileWithDirectory(path, data, 0644)
 }
 
 func writeFileWithDirectory(path string, data []byte, perm os.FileMode) error {
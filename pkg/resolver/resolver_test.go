@@ -1,18 +1,26 @@
 package resolver
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/golang/mock/gomock"
 	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/require"
 
 	"github.com/stormcat24/protodep/pkg/auth"
 	"github.com/stormcat24/protodep/pkg/config"
+	"github.com/stormcat24/protodep/pkg/logger"
+	"github.com/stormcat24/protodep/pkg/repository"
 )
 
 func TestSync(t *testing.T) {
@@ -44,19 +52,19 @@ func TestSync(t *testing.T) {
 	defer c.Finish()
 
 	httpsAuthProviderMock := auth.NewMockAuthProvider(c)
-	httpsAuthProviderMock.EXPECT().AuthMethod().Return(nil, nil).AnyTimes()
+	httpsAuthProviderMock.EXPECT().AuthMethod(gomock.Any()).Return(nil, nil).AnyTimes()
 	httpsAuthProviderMock.EXPECT().GetRepositoryURL("github.com/protocolbuffers/protobuf").Return("https://github.com/protocolbuffers/protobuf.git")
 	httpsAuthProviderMock.EXPECT().GetRepositoryURL("github.com/protodep/catalog").Return("https://github.com/protodep/catalog.git")
 
 	sshAuthProviderMock := auth.NewMockAuthProvider(c)
-	sshAuthProviderMock.EXPECT().AuthMethod().Return(nil, nil).AnyTimes()
+	sshAuthProviderMock.EXPECT().AuthMethod(gomock.Any()).Return(nil, nil).AnyTimes()
 	sshAuthProviderMock.EXPECT().GetRepositoryURL("github.com/opensaasstudio/plasma").Return("https://github.com/opensaasstudio/plasma.git")
 
 	target.SetHttpsAuthProvider(httpsAuthProviderMock)
 	target.SetSshAuthProvider(sshAuthProviderMock)
 
 	// clone
-	err = target.Resolve(false, false)
+	_, err = target.Resolve(context.Background(), Options{})
 	require.NoError(t, err)
 
 	if !isFileExist(filepath.Join(outputRootDir, "proto/stream.proto")) {
@@ -100,7 +108,7 @@ func TestSync(t *testing.T) {
 
 
 	// fetch
-	err = target.Resolve(false, false)
+	_, err = target.Resolve(context.Background(), Options{})
 	require.NoError(t, err)
 }
 
@@ -109,36 +117,6 @@ func isFileExist(path string) bool {
 	return !os.IsNotExist(err)
 }
 
-func TestWriteToml(t *testing.T) {
-
-	config := config.ProtoDep{
-		ProtoOutdir: "./proto",
-		Dependencies: []config.ProtoDepDependency{
-			config.ProtoDepDependency{
-				Target:   "github.com/openfresh/plasma/protobuf",
-				Branch:   "master",
-				Revision: "d7ee1d95b6700756b293b722a1cfd4b905a351ba",
-			},
-			config.ProtoDepDependency{
-				Target:   "github.com/grpc-ecosystem/grpc-gateway/examples/examplepb",
-				Branch:   "master",
-				Revision: "c6f7a5ac629444a556bb665e389e41b897ebad39",
-			},
-		},
-	}
-
-	destDir := os.TempDir()
-	destFile := filepath.Join(destDir, "protodep.lock")
-
-	require.NoError(t, os.MkdirAll(os.TempDir(), 0777))
-	require.NoError(t, writeToml(destFile, config))
-
-	stat, err := os.Stat(destFile)
-	require.NoError(t, err)
-
-	require.True(t, !stat.IsDir())
-}
-
 func TestWriteFileWithDirectory(t *testing.T) {
 	destDir := os.TempDir()
 	testDir := filepath.Join(destDir, "hoge")
@@ -168,3 +146,1034 @@ func TestIsAvailableSSH(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, notFound)
 }
+
+func TestResolveParallel(t *testing.T) {
+	protobufRepo := newTestRepository(t, map[string]string{
+		"src/google/protobuf/empty.proto": `syntax = "proto3";`,
+		"src/google/protobuf/any.proto":   `syntax = "proto3";`,
+		"examples/addressbook.proto":      `syntax = "proto3";`,
+	})
+	catalogRepo := newTestRepository(t, map[string]string{
+		"hierarchy/service.proto": `syntax = "proto3";`,
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/protocolbuffers/protobuf/src"
+  branch = "master"
+
+[[dependencies]]
+  target = "github.com/protodep/catalog/hierarchy"
+  branch = "master"
+
+[[dependencies]]
+  target = "github.com/protocolbuffers/protobuf/examples"
+  branch = "master"
+  path = "examples"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+		Jobs:      3,
+	}, map[string]string{
+		"github.com/protocolbuffers/protobuf": protobufRepo,
+		"github.com/protodep/catalog":         catalogRepo,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/google/protobuf/empty.proto")))
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/google/protobuf/any.proto")))
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/service.proto")))
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/examples/addressbook.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).Load()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 3)
+	require.Equal(t, "github.com/protocolbuffers/protobuf/src", lock.Dependencies[0].Target)
+	require.Equal(t, "github.com/protodep/catalog/hierarchy", lock.Dependencies[1].Target)
+	require.Equal(t, "github.com/protocolbuffers/protobuf/examples", lock.Dependencies[2].Target)
+	for _, dep := range lock.Dependencies {
+		require.Len(t, dep.Revision, 40)
+	}
+}
+
+// newTestRepository creates a git repository containing files and returns its path.
+func newTestRepository(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	_, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+
+	commitTestFiles(t, dir, files)
+
+	return dir
+}
+
+// commitTestFiles writes files into the repository at dir, commits them and returns the commit hash.
+func commitTestFiles(t *testing.T, dir string, files map[string]string) plumbing.Hash {
+	t.Helper()
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, name), content)
+		_, err := wt.Add(name)
+		require.NoError(t, err)
+	}
+
+	hash, err := wt.Commit("update", &git.CommitOptions{
+		Author: &object.Signature{Name: "protodep", Email: "protodep@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	return hash
+}
+
+// headOf returns the commit hash HEAD points to in the repository at dir.
+func headOf(t *testing.T, dir string) plumbing.Hash {
+	t.Helper()
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+
+	return head.Hash()
+}
+
+// tagTestRepository creates a lightweight tag at hash in the repository at dir.
+func tagTestRepository(t *testing.T, dir string, tag string, hash plumbing.Hash) {
+	t.Helper()
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	_, err = repo.CreateTag(tag, hash, nil)
+	require.NoError(t, err)
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	require.NoError(t, writeFileWithDirectory(path, []byte(content), 0644))
+}
+
+func TestResolveVersion(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3";`,
+	})
+	tagTestRepository(t, upstreamRepo, "v1.3.0", headOf(t, upstreamRepo))
+
+	versions := []string{"v1.4.0", "v1.5.0", "v2.0.0"}
+	hashes := make(map[string]plumbing.Hash)
+	for _, version := range versions {
+		hashes[version] = commitTestFiles(t, upstreamRepo, map[string]string{
+			"proto/service.proto": fmt.Sprintf(`syntax = "proto3"; // %s`, version),
+		})
+		tagTestRepository(t, upstreamRepo, version, hashes[version])
+	}
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  version = "^1.4.0"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "proto/service.proto"))
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3"; // v1.5.0`, string(content))
+
+	lock, err := config.NewDependency(targetDir, false).Load()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 1)
+	require.Equal(t, "^1.4.0", lock.Dependencies[0].Version)
+	require.Equal(t, "v1.5.0", lock.Dependencies[0].Tag)
+	require.Equal(t, hashes["v1.5.0"].String(), lock.Dependencies[0].Revision)
+}
+
+func TestResolveRewrittenTag(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3";`,
+	})
+	tagTestRepository(t, upstreamRepo, "v1.0.0", headOf(t, upstreamRepo))
+
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  revision = "v1.0.0"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: t.TempDir(),
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0", lock.Dependencies[0].Tag)
+	require.NotEmpty(t, lock.Dependencies[0].TreeHash)
+
+	// Re-resolving an unchanged tag is fine.
+	_, err = target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+
+	rewritten := commitTestFiles(t, upstreamRepo, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; package rewritten;`,
+	})
+	repo, err := git.PlainOpen(upstreamRepo)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteTag("v1.0.0"))
+	tagTestRepository(t, upstreamRepo, "v1.0.0", rewritten)
+
+	_, err = target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.ErrorContains(t, err, "tag v1.0.0 now points to")
+}
+
+func TestResolveOffline(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3";`,
+	})
+
+	homeDir := t.TempDir()
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+`)
+
+	online := newTestResolver(t, &Config{
+		HomeDir:   homeDir,
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+	_, err := online.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	// The offline resolver knows no repository, so the mock fails the test if it fetches.
+	offline := newTestResolver(t, &Config{
+		HomeDir:   homeDir,
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+		Offline:   true,
+	}, nil)
+
+	require.NoError(t, os.RemoveAll(filepath.Join(outputDir, "proto")))
+	_, err = offline.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/service.proto")))
+
+	_, err = offline.Resolve(context.Background(), Options{CleanupCache: true})
+	require.ErrorContains(t, err, "not allowed in offline mode")
+
+	writeTestFile(t, filepath.Join(targetDir, "protodep.lock"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  revision = "c6f7a5ac629444a556bb665e389e41b897ebad39"
+
+[[dependencies]]
+  target = "github.com/stormcat24/uncached/proto"
+  revision = "d7ee1d95b6700756b293b722a1cfd4b905a351ba"
+`)
+
+	_, err = offline.Resolve(context.Background(), Options{})
+	require.ErrorIs(t, err, repository.ErrNotCached)
+	require.ErrorContains(t, err, "2 dependencies are not available offline")
+	require.ErrorContains(t, err, "github.com/stormcat24/upstream at c6f7a5ac629444a556bb665e389e41b897ebad39")
+	require.ErrorContains(t, err, "github.com/stormcat24/uncached")
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestResolveLocalSource(t *testing.T) {
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "shared", "proto", "common", "common.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "shared/proto"
+  source = "local"
+  path = "shared"
+`)
+
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	})
+	require.NoError(t, err)
+	_, err = target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3";`, readTestFile(t, filepath.Join(outputDir, "proto", "shared", "common", "common.proto")))
+
+	// Local sources have no revision, so changed content is vendored without an integrity error.
+	writeTestFile(t, filepath.Join(targetDir, "shared", "proto", "common", "common.proto"), `syntax = "proto3"; // changed`)
+	_, err = target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3"; // changed`, readTestFile(t, filepath.Join(outputDir, "proto", "shared", "common", "common.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, config.SourceLocal, lock.Dependencies[0].Source)
+	require.Empty(t, lock.Dependencies[0].Revision)
+}
+
+func TestResolveBSRSource(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"contents":[{
+			"commit":{"id":"7a6bc1e3707148a4b4d1f2e6d7e9c0a1","digest":{"type":"DIGEST_TYPE_B5","value":"AQID"}},
+			"files":[{"path":"acme/weather/v1/weather.proto","content":"c3ludGF4ID0gInByb3RvMyI7"}]
+		}]}`))
+	}))
+	defer registry.Close()
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "buf.build/acme/weather"
+  source = "bsr"
+  branch = "main"
+  url = "%s"
+`, registry.URL))
+
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	})
+	require.NoError(t, err)
+	_, err = target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/acme/weather/v1/weather.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, "7a6bc1e3707148a4b4d1f2e6d7e9c0a1", lock.Dependencies[0].Revision)
+	require.Equal(t, "b5:010203", lock.Dependencies[0].Digest)
+}
+
+func TestResolveBSRSourceImportedLock(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"contents":[{
+			"commit":{"id":"7a6bc1e3707148a4b4d1f2e6d7e9c0a1","digest":{"type":"DIGEST_TYPE_B5","value":"AQID"}},
+			"files":[{"path":"acme/weather/v1/weather.proto","content":"c3ludGF4ID0gInByb3RvMyI7"}]
+		}]}`))
+	}))
+	defer registry.Close()
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "buf.build/acme/weather"
+  source = "bsr"
+  branch = "main"
+  url = "%s"
+`, registry.URL))
+	// protodep import buf pins the commits of buf.lock without files.
+	writeTestFile(t, filepath.Join(targetDir, "protodep.lock"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "buf.build/acme/weather"
+  source = "bsr"
+  branch = "main"
+  revision = "7a6bc1e3707148a4b4d1f2e6d7e9c0a1"
+  digest = "b5:010203"
+  url = "%s"
+`, registry.URL))
+	writeTestFile(t, filepath.Join(outputDir, "proto/local.proto"), `syntax = "proto3";`)
+
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	})
+	require.NoError(t, err)
+	_, err = target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/acme/weather/v1/weather.proto")))
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/local.proto")))
+}
+
+func TestResolveTargets(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v1`,
+	})
+	catalogRepo := newTestRepository(t, map[string]string{
+		"catalog.proto": `syntax = "proto3"; // v1`,
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "upstream"
+
+[[dependencies]]
+  target = "github.com/stormcat24/catalog"
+  branch = "master"
+  path = "catalog"
+`)
+
+	conf := &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}
+	target := newTestResolver(t, conf, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+		"github.com/stormcat24/catalog":  catalogRepo,
+	})
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	branch, err := target.DefaultBranch(context.Background(), config.ProtoDepDependency{Target: "github.com/stormcat24/catalog"})
+	require.NoError(t, err)
+	require.Equal(t, "master", branch)
+
+	commitTestFiles(t, upstreamRepo, map[string]string{"proto/service.proto": `syntax = "proto3"; // v2`})
+	commitTestFiles(t, catalogRepo, map[string]string{"catalog.proto": `syntax = "proto3"; // v2`})
+
+	_, err = target.Resolve(context.Background(), Options{Targets: []string{"github.com/stormcat24/catalog"}})
+	require.NoError(t, err)
+
+	// Only the target moved to the new commit, the other dependency kept its locked revision.
+	require.Equal(t, `syntax = "proto3"; // v1`, readTestFile(t, filepath.Join(outputDir, "proto/upstream/service.proto")))
+	require.Equal(t, `syntax = "proto3"; // v2`, readTestFile(t, filepath.Join(outputDir, "proto/catalog/catalog.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, headOf(t, catalogRepo).String(), lock.Dependencies[1].Revision)
+	require.NotEqual(t, headOf(t, upstreamRepo).String(), lock.Dependencies[0].Revision)
+
+	_, err = target.Resolve(context.Background(), Options{Targets: []string{"github.com/stormcat24/unknown"}})
+	require.ErrorContains(t, err, "not in protodep.toml: github.com/stormcat24/unknown")
+
+	// A target that is only left in protodep.lock is removed with its files.
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "upstream"
+`)
+	_, err = target.Resolve(context.Background(), Options{Targets: []string{"github.com/stormcat24/catalog"}})
+	require.NoError(t, err)
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto/catalog")))
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto/upstream/service.proto")))
+
+	lock, err = config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 1)
+}
+
+func TestResolveTargetsSharedTarget(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v1`,
+	})
+	first := headOf(t, upstreamRepo)
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "stable"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "edge"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	second := commitTestFiles(t, upstreamRepo, map[string]string{"proto/service.proto": `syntax = "proto3"; // v2`})
+
+	edge := config.ProtoDepDependency{Target: "github.com/stormcat24/upstream/proto", Path: "edge"}
+	_, err = target.Resolve(context.Background(), Options{Targets: []string{Key(edge)}})
+	require.NoError(t, err)
+
+	// Only the entry with the path moved, the other entry of the target kept its revision.
+	require.Equal(t, `syntax = "proto3"; // v1`, readTestFile(t, filepath.Join(outputDir, "proto/stable/service.proto")))
+	require.Equal(t, `syntax = "proto3"; // v2`, readTestFile(t, filepath.Join(outputDir, "proto/edge/service.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, first.String(), lock.Dependencies[0].Revision)
+	require.Equal(t, second.String(), lock.Dependencies[1].Revision)
+
+	// Removing one entry leaves the other entry of the target at its revision.
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "stable"
+`)
+	_, err = target.Resolve(context.Background(), Options{Targets: []string{Key(edge)}})
+	require.NoError(t, err)
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto/edge")))
+	require.Equal(t, `syntax = "proto3"; // v1`, readTestFile(t, filepath.Join(outputDir, "proto/stable/service.proto")))
+
+	lock, err = config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Len(t, lock.Dependencies, 1)
+	require.Equal(t, first.String(), lock.Dependencies[0].Revision)
+}
+
+func TestResolveIncremental(t *testing.T) {
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "shared", "common", "unchanged.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "shared", "common", "changed.proto"), `syntax = "proto3"; // v1`)
+	writeTestFile(t, filepath.Join(targetDir, "shared", "legacy", "removed.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "shared"
+  source = "local"
+`)
+	writeTestFile(t, filepath.Join(outputDir, "proto", "BUILD.bazel"), `# not vendored by protodep`)
+
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	})
+	require.NoError(t, err)
+	_, err = target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	unchanged := filepath.Join(outputDir, "proto", "common", "unchanged.proto")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(unchanged, past, past))
+
+	writeTestFile(t, filepath.Join(targetDir, "shared", "common", "changed.proto"), `syntax = "proto3"; // v2`)
+	require.NoError(t, os.RemoveAll(filepath.Join(targetDir, "shared", "legacy")))
+	_, err = target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+
+	stat, err := os.Stat(unchanged)
+	require.NoError(t, err)
+	require.Equal(t, past, stat.ModTime())
+	require.Equal(t, `syntax = "proto3"; // v2`, readTestFile(t, filepath.Join(outputDir, "proto", "common", "changed.proto")))
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto", "legacy")))
+	require.Equal(t, `# not vendored by protodep`, readTestFile(t, filepath.Join(outputDir, "proto", "BUILD.bazel")))
+}
+
+func TestResolveUnlistedFiles(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/common.proto": `syntax = "proto3";`,
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "shared"
+`)
+	// protodep.lock of an older version, without the vendored files.
+	writeTestFile(t, filepath.Join(targetDir, "protodep.lock"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  revision = "%s"
+  path = "shared"
+`, headOf(t, upstreamRepo)))
+	writeTestFile(t, filepath.Join(outputDir, "proto", "shared", "common.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(outputDir, "proto", "shared", "removed.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(outputDir, "proto", "shared", "BUILD.bazel"), `# not vendored by protodep`)
+	writeTestFile(t, filepath.Join(outputDir, "proto", "myapp", "app.proto"), `syntax = "proto3";`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	result, err := target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"shared/removed.proto"}, result.RemovedFiles)
+
+	// Only the .proto files under the path of the dependency were its own.
+	require.True(t, isFileExist(filepath.Join(outputDir, "proto", "shared", "common.proto")))
+	require.False(t, isFileExist(filepath.Join(outputDir, "proto", "shared", "removed.proto")))
+	require.Equal(t, `# not vendored by protodep`, readTestFile(t, filepath.Join(outputDir, "proto", "shared", "BUILD.bazel")))
+	require.Equal(t, `syntax = "proto3";`, readTestFile(t, filepath.Join(outputDir, "proto", "myapp", "app.proto")))
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.NotEmpty(t, lock.Dependencies[0].TreeHash)
+	require.Len(t, lock.Dependencies[0].Files, 1)
+}
+
+func TestResolveLockWithoutDigests(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3";`,
+	})
+	first := headOf(t, upstreamRepo)
+	commitTestFiles(t, upstreamRepo, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; package service;`,
+	})
+
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+`)
+	// protodep.lock of an older version, without digests.
+	writeTestFile(t, filepath.Join(targetDir, "protodep.lock"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  revision = "%s"
+`, first))
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: t.TempDir(),
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	result, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(targetDir, "protodep.lock"), result.LockFile)
+
+	// The digests are recorded without moving to the head of the branch.
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, first.String(), lock.Dependencies[0].Revision)
+	require.NotEmpty(t, lock.Dependencies[0].TreeHash)
+	require.Len(t, lock.Dependencies[0].Files, 1)
+}
+
+func TestResolveResult(t *testing.T) {
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "shared", "proto", "a.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "shared", "proto", "b.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "shared/proto"
+  source = "local"
+`)
+
+	// The working directory is not used, protodep.lock is written next to protodep.toml.
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+	})
+	require.NoError(t, err)
+
+	result, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(targetDir, "proto"), result.ProtoOutdir)
+	require.Equal(t, []string{"a.proto", "b.proto"}, result.WrittenFiles)
+	require.Empty(t, result.RemovedFiles)
+	require.Equal(t, filepath.Join(targetDir, "protodep.lock"), result.LockFile)
+	require.Len(t, result.Dependencies, 1)
+	require.Equal(t, result.Dependencies, result.Lock.Dependencies)
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, result.Lock.Dependencies[0].TreeHash, lock.Dependencies[0].TreeHash)
+
+	writeTestFile(t, filepath.Join(targetDir, "shared", "proto", "a.proto"), `syntax = "proto3"; // changed`)
+	require.NoError(t, os.Remove(filepath.Join(targetDir, "shared", "proto", "b.proto")))
+	result, err = target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.proto"}, result.WrittenFiles)
+	require.Equal(t, []string{"b.proto"}, result.RemovedFiles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = target.Resolve(ctx, Options{ForceUpdate: true})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = New(&Config{HomeDir: t.TempDir()})
+	require.Error(t, err)
+}
+
+func TestResolveFetchTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "example/hung"
+  source = "archive"
+  url = "%s/hung.tar.gz"
+`, server.URL))
+
+	target, err := New(&Config{
+		HomeDir:      t.TempDir(),
+		TargetDir:    targetDir,
+		FetchTimeout: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	_, err = target.Resolve(context.Background(), Options{})
+	require.ErrorContains(t, err, "fetch example/hung: timed out after 100ms")
+	require.NoFileExists(t, filepath.Join(targetDir, "protodep.lock"))
+}
+
+func TestResolveRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		status   int
+		// then is the status after the failures, a success when it is 0.
+		then     int
+		requests int
+		err      string
+	}{
+		{
+			name:     "recovers from 5xx",
+			failures: 2,
+			status:   http.StatusServiceUnavailable,
+			requests: 3,
+		},
+		{
+			name:     "gives up after retries",
+			failures: 5,
+			status:   http.StatusBadGateway,
+			requests: 3,
+			err:      "buf.build/acme/weather failed after 3 attempts: download buf.build/acme/weather: 502 Bad Gateway",
+		},
+		{
+			name:     "does not retry not found",
+			failures: 5,
+			status:   http.StatusNotFound,
+			requests: 1,
+			err:      "download buf.build/acme/weather: 404 Not Found",
+		},
+		{
+			name:     "reports retries before a permanent failure",
+			failures: 1,
+			status:   http.StatusServiceUnavailable,
+			then:     http.StatusNotFound,
+			requests: 2,
+			err:      "buf.build/acme/weather failed after 2 attempts: download buf.build/acme/weather: 404 Not Found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				if tt.then != 0 {
+					w.WriteHeader(tt.then)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"contents":[{
+					"commit":{"id":"7a6bc1e3707148a4b4d1f2e6d7e9c0a1"},
+					"files":[{"path":"acme/weather/v1/weather.proto","content":"c3ludGF4ID0gInByb3RvMyI7"}]
+				}]}`))
+			}))
+			defer registry.Close()
+
+			targetDir := t.TempDir()
+			writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "buf.build/acme/weather"
+  source = "bsr"
+  url = "%s"
+`, registry.URL))
+
+			target, err := New(&Config{
+				HomeDir:      t.TempDir(),
+				TargetDir:    targetDir,
+				Retries:      2,
+				RetryBackoff: time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			_, err = target.Resolve(context.Background(), Options{})
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+			require.Equal(t, tt.requests, requests)
+		})
+	}
+}
+
+func TestResolveAtomic(t *testing.T) {
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "shared", "a", "a.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "shared", "b", "b.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "shared/a"
+  source = "local"
+
+[[dependencies]]
+  target = "shared/b"
+  source = "local"
+`)
+
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+	})
+	require.NoError(t, err)
+
+	_, err = target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+	lock := readTestFile(t, filepath.Join(targetDir, "protodep.lock"))
+
+	// shared/a changes, but shared/b is gone, so nothing is updated.
+	writeTestFile(t, filepath.Join(targetDir, "shared", "a", "a.proto"), `syntax = "proto3"; // changed`)
+	require.NoError(t, os.RemoveAll(filepath.Join(targetDir, "shared", "b")))
+
+	_, err = target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.Error(t, err)
+	require.Equal(t, `syntax = "proto3";`, readTestFile(t, filepath.Join(targetDir, "proto", "a.proto")))
+	require.Equal(t, `syntax = "proto3";`, readTestFile(t, filepath.Join(targetDir, "proto", "b.proto")))
+	require.Equal(t, lock, readTestFile(t, filepath.Join(targetDir, "protodep.lock")))
+
+	// The staging directory is removed.
+	entries, err := os.ReadDir(targetDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{"shared", "proto", "protodep.toml", "protodep.lock"}, names)
+
+	// Once shared/b is back, the run succeeds and keeps the files that did not change.
+	writeTestFile(t, filepath.Join(targetDir, "shared", "b", "b.proto"), `syntax = "proto3";`)
+	result, err := target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.proto"}, result.WrittenFiles)
+	require.Equal(t, `syntax = "proto3"; // changed`, readTestFile(t, filepath.Join(targetDir, "proto", "a.proto")))
+
+	entries, err = os.ReadDir(targetDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+}
+
+func TestResolveKeepGoing(t *testing.T) {
+	targetDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "shared", "a", "a.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "shared", "c", "c.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "shared/a"
+  source = "local"
+
+[[dependencies]]
+  target = "shared/missing"
+  source = "local"
+
+[[dependencies]]
+  target = "shared/c"
+  source = "local"
+  ignores = ["[unclosed"]
+
+[[dependencies]]
+  target = "github.com/stormcat24/protodep"
+  protocol = "ftp"
+`)
+
+	target, err := New(&Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+	})
+	require.NoError(t, err)
+
+	_, err = target.Resolve(context.Background(), Options{KeepGoing: true})
+	var depsErr *DependenciesError
+	require.ErrorAs(t, err, &depsErr)
+	require.Equal(t, 4, depsErr.Total)
+	require.Len(t, depsErr.Errors, 3)
+	require.Equal(t, "shared/missing", depsErr.Errors[0].Target)
+	require.Equal(t, "shared/c", depsErr.Errors[1].Target)
+	require.ErrorContains(t, depsErr.Errors[1], `invalid pattern "[unclosed"`)
+	require.Equal(t, "github.com/stormcat24/protodep", depsErr.Errors[2].Target)
+
+	// Nothing is written when a dependency failed.
+	require.NoDirExists(t, filepath.Join(targetDir, "proto"))
+	require.NoFileExists(t, filepath.Join(targetDir, "protodep.lock"))
+
+	// Without KeepGoing, the first failure is returned. It was printed as an error event.
+	_, err = target.Resolve(context.Background(), Options{})
+	require.Error(t, err)
+	_, ok := err.(*DependenciesError)
+	require.False(t, ok)
+	require.True(t, logger.IsReported(err))
+}
+
+func TestResolveShallow(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v1`,
+	})
+	first := headOf(t, upstreamRepo)
+	second := commitTestFiles(t, upstreamRepo, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v2`,
+	})
+	commitTestFiles(t, upstreamRepo, map[string]string{
+		"proto/service.proto": `syntax = "proto3"; // v3`,
+	})
+
+	targetDir := t.TempDir()
+	homeDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   homeDir,
+		TargetDir: targetDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	result, err := target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3"; // v3`, readTestFile(t, filepath.Join(targetDir, "proto", "service.proto")))
+	require.Positive(t, result.CacheSize)
+
+	// Only the head of the branch is cloned.
+	cache, err := git.PlainOpen(filepath.Join(homeDir, ".protodep", "github.com", "stormcat24", "upstream"))
+	require.NoError(t, err)
+	shallows, err := cache.Storer.Shallow()
+	require.NoError(t, err)
+	require.Len(t, shallows, 1)
+	_, err = cache.CommitObject(second)
+	require.Error(t, err)
+
+	// A revision that cannot be fetched alone is found in the history of the branch.
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), fmt.Sprintf(`proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  revision = "%s"
+`, first))
+
+	_, err = target.Resolve(context.Background(), Options{ForceUpdate: true})
+	require.NoError(t, err)
+	require.Equal(t, `syntax = "proto3"; // v1`, readTestFile(t, filepath.Join(targetDir, "proto", "service.proto")))
+
+	// The whole history is there now, so the clone is no longer shallow.
+	cache, err = git.PlainOpen(filepath.Join(homeDir, ".protodep", "github.com", "stormcat24", "upstream"))
+	require.NoError(t, err)
+	shallows, err = cache.Storer.Shallow()
+	require.NoError(t, err)
+	require.Empty(t, shallows)
+}
+
+// newTestResolver creates a resolver for conf that clones repos, a map from repository
+// names like github.com/foo/bar to the paths of local repositories, over SSH.
+func newTestResolver(t *testing.T, conf *Config, repos map[string]string) Resolver {
+	t.Helper()
+
+	c := gomock.NewController(t)
+	t.Cleanup(c.Finish)
+
+	sshAuthProviderMock := auth.NewMockAuthProvider(c)
+	sshAuthProviderMock.EXPECT().AuthMethod(gomock.Any()).Return(nil, nil).AnyTimes()
+	for name, path := range repos {
+		sshAuthProviderMock.EXPECT().GetRepositoryURL(name).Return(path).AnyTimes()
+	}
+
+	target, err := New(conf)
+	require.NoError(t, err)
+	target.SetSshAuthProvider(sshAuthProviderMock)
+
+	return target
+}
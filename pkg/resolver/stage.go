@@ -0,0 +1,161 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stage is a copy of proto_outdir next to it. Dependencies are vendored into the copy,
+// which replaces proto_outdir only once every dependency is resolved, so a failed run
+// leaves proto_outdir as it was.
+type stage struct {
+	outdir string
+	dir    string
+}
+
+// newStage creates the staging directory of outdir with a copy of its current files.
+func newStage(outdir string) (*stage, error) {
+	parent := filepath.Dir(outdir)
+	if err := os.MkdirAll(parent, 0777); err != nil {
+		return nil, fmt.Errorf("create directory %s: %w", parent, err)
+	}
+
+	dir, err := os.MkdirTemp(parent, "."+filepath.Base(outdir)+".staging-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	st := &stage{outdir: outdir, dir: dir}
+
+	if stat, err := os.Stat(outdir); err == nil && stat.IsDir() {
+		if err := copyTree(outdir, dir); err != nil {
+			st.discard()
+			return nil, fmt.Errorf("copy %s to staging directory: %w", outdir, err)
+		}
+	}
+	return st, nil
+}
+
+// commit swaps the staged tree in for outdir, then calls write. When write fails, the
+// previous outdir is put back. The swap is not atomic: outdir is moved aside before the
+// staged tree is moved in, so for a moment it does not exist. When the previous outdir
+// cannot be put back, the error names where it was moved.
+func (st *stage) commit(write func() error) error {
+	backup := st.dir + ".previous"
+	hasPrevious := false
+	if _, err := os.Stat(st.outdir); err == nil {
+		if err := os.Rename(st.outdir, backup); err != nil {
+			return fmt.Errorf("move %s aside: %w", st.outdir, err)
+		}
+		hasPrevious = true
+	}
+
+	restore := func() error {
+		if !hasPrevious {
+			return nil
+		}
+		if err := os.Rename(backup, st.outdir); err != nil {
+			return fmt.Errorf("put back %s, its previous files are in %s: %w", st.outdir, backup, err)
+		}
+		return nil
+	}
+
+	if err := os.Rename(st.dir, st.outdir); err != nil {
+		return errors.Join(fmt.Errorf("move staged files to %s: %w", st.outdir, err), restore())
+	}
+
+	if writeErr := write(); writeErr != nil {
+		if err := os.Rename(st.outdir, st.dir); err != nil {
+			err = fmt.Errorf("move new files out of %s: %w", st.outdir, err)
+			if hasPrevious {
+				err = fmt.Errorf("%w, its previous files are in %s", err, backup)
+			}
+			return errors.Join(writeErr, err)
+		}
+		return errors.Join(writeErr, restore())
+	}
+
+	if hasPrevious {
+		if err := os.RemoveAll(backup); err != nil {
+			return fmt.Errorf("remove previous %s: %w", st.outdir, err)
+		}
+	}
+	return nil
+}
+
+// discard removes the staging directory. It does nothing after a successful commit.
+func (st *stage) discard() {
+	os.RemoveAll(st.dir)
+}
+
+// copyTree copies the files, directories and symbolic links under src into dest, keeping
+// modes and modification times so that unchanged files still look unchanged.
+func copyTree(src string, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if rel == "." {
+				return os.Chmod(dest, info.Mode().Perm())
+			}
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src string, dest string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isWithin reports whether path is dir or under it.
+func isWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
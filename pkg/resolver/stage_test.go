@@ -0,0 +1,36 @@
+package resolver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageCommit(t *testing.T) {
+	outdir := filepath.Join(t.TempDir(), "proto")
+	writeTestFile(t, filepath.Join(outdir, "a.proto"), `syntax = "proto3";`)
+
+	st, err := newStage(outdir)
+	require.NoError(t, err)
+	defer st.discard()
+	writeTestFile(t, filepath.Join(st.dir, "a.proto"), `syntax = "proto3"; // changed`)
+
+	// A failed write puts the previous outdir back.
+	err = st.commit(func() error {
+		return errors.New("write protodep.lock")
+	})
+	require.EqualError(t, err, "write protodep.lock")
+	require.Equal(t, `syntax = "proto3";`, readTestFile(t, filepath.Join(outdir, "a.proto")))
+
+	// When it cannot be put back, the error tells where it was moved.
+	backup := st.dir + ".previous"
+	err = st.commit(func() error {
+		require.NoError(t, os.Rename(backup, filepath.Join(t.TempDir(), "previous")))
+		return errors.New("write protodep.lock")
+	})
+	require.ErrorContains(t, err, "write protodep.lock")
+	require.ErrorContains(t, err, "its previous files are in "+backup)
+}
@@ -0,0 +1,119 @@
+package resolver
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+// DriftKind describes how a vendored file differs from protodep.lock.
+type DriftKind string
+
+const (
+	// DriftMissing is a file recorded in protodep.lock that does not exist under proto_outdir.
+	DriftMissing DriftKind = "missing"
+	// DriftModified is a file whose content does not match the digest in protodep.lock.
+	DriftModified DriftKind = "modified"
+	// DriftUnexpected is a .proto file that is not recorded in protodep.lock, under the path
+	// of a dependency or next to vendored files. Other files, like build files or protos
+	// of the project itself elsewhere in proto_outdir, are not reported.
+	DriftUnexpected DriftKind = "unexpected"
+)
+
+// Drift is a vendored file that differs from protodep.lock.
+type Drift struct {
+	Kind DriftKind
+	// Path is relative to proto_outdir and uses forward slashes.
+	Path string
+	// Target is the dependency the file belongs to, empty for unexpected files.
+	Target string
+}
+
+// Verify compares the files under proto_outdir with the digests recorded in protodep.lock
+// without fetching or rewriting anything. The result is sorted by path.
+func (s *resolver) Verify() ([]Drift, error) {
+	lock, err := config.NewDependency(s.conf.TargetDir, false).LoadLock()
+	if err != nil {
+		return nil, err
+	}
+
+	outdir := filepath.Join(s.conf.outputDir(), lock.ProtoOutdir)
+
+	drifts := make([]Drift, 0)
+	recorded := make(map[string]bool)
+	ownedDirs := make(map[string]bool)
+	ownedPaths := make([]string, 0)
+	for _, dep := range lock.Dependencies {
+		if dep.TreeHash == "" {
+			return nil, fmt.Errorf("protodep.lock has no file digests for %s, run protodep up -f to record them", dep.Target)
+		}
+		if dep.Path != "" {
+			ownedPaths = append(ownedPaths, filepath.Join(outdir, filepath.FromSlash(dep.Path)))
+		}
+
+		for _, file := range dep.Files {
+			recorded[file.Path] = true
+			ownedDirs[path.Dir(file.Path)] = true
+
+			content, err := os.ReadFile(filepath.Join(outdir, filepath.FromSlash(file.Path)))
+			if os.IsNotExist(err) {
+				drifts = append(drifts, Drift{Kind: DriftMissing, Path: file.Path, Target: dep.Target})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if fileDigest(content) != file.Hash {
+				drifts = append(drifts, Drift{Kind: DriftModified, Path: file.Path, Target: dep.Target})
+			}
+		}
+	}
+
+	// Only files where protodep vendors are reported, not the other protos in proto_outdir.
+	isOwned := func(file string, relpath string) bool {
+		for _, owned := range ownedPaths {
+			if isWithin(file, owned) {
+				return true
+			}
+		}
+		return ownedDirs[path.Dir(relpath)]
+	}
+
+	err = filepath.WalkDir(outdir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == outdir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(file) != ".proto" {
+			return nil
+		}
+
+		relpath, err := filepath.Rel(outdir, file)
+		if err != nil {
+			return err
+		}
+		relpath = filepath.ToSlash(relpath)
+
+		if !recorded[relpath] && isOwned(file, relpath) {
+			drifts = append(drifts, Drift{Kind: DriftUnexpected, Path: relpath})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", outdir, err)
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		return drifts[i].Path < drifts[j].Path
+	})
+
+	return drifts, nil
+}
@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stormcat24/protodep/pkg/config"
+)
+
+func TestVerify(t *testing.T) {
+	upstreamRepo := newTestRepository(t, map[string]string{
+		"proto/service.proto":   `syntax = "proto3";`,
+		"proto/model/foo.proto": `syntax = "proto3";`,
+		"proto/model/bar.proto": `syntax = "proto3";`,
+	})
+
+	targetDir := t.TempDir()
+	outputDir := t.TempDir()
+	writeTestFile(t, filepath.Join(targetDir, "protodep.toml"), `proto_outdir = "./proto"
+
+[[dependencies]]
+  target = "github.com/stormcat24/upstream/proto"
+  branch = "master"
+  path = "upstream"
+`)
+
+	target := newTestResolver(t, &Config{
+		HomeDir:   t.TempDir(),
+		TargetDir: targetDir,
+		OutputDir: outputDir,
+	}, map[string]string{
+		"github.com/stormcat24/upstream": upstreamRepo,
+	})
+
+	_, err := target.Resolve(context.Background(), Options{})
+	require.NoError(t, err)
+
+	lock, err := config.NewDependency(targetDir, false).LoadLock()
+	require.NoError(t, err)
+	require.Equal(t, []config.ProtoDepFile{
+		{Path: "upstream/model/bar.proto", Hash: fileDigest([]byte(`syntax = "proto3";`))},
+		{Path: "upstream/model/foo.proto", Hash: fileDigest([]byte(`syntax = "proto3";`))},
+		{Path: "upstream/service.proto", Hash: fileDigest([]byte(`syntax = "proto3";`))},
+	}, lock.Dependencies[0].Files)
+
+	drifts, err := target.Verify()
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+
+	protoDir := filepath.Join(outputDir, "proto")
+	writeTestFile(t, filepath.Join(protoDir, "upstream/service.proto"), `syntax = "proto2";`)
+	require.NoError(t, os.Remove(filepath.Join(protoDir, "upstream/model/foo.proto")))
+	writeTestFile(t, filepath.Join(protoDir, "upstream/model/baz.proto"), `syntax = "proto3";`)
+	writeTestFile(t, filepath.Join(protoDir, "upstream/BUILD.bazel"), `proto_library(name = "upstream")`)
+	writeTestFile(t, filepath.Join(protoDir, "upstream/extra/extra.proto"), `syntax = "proto3";`)
+	// The protos of the project itself elsewhere in proto_outdir are not reported.
+	writeTestFile(t, filepath.Join(protoDir, "myapp/app.proto"), `syntax = "proto3";`)
+
+	drifts, err = target.Verify()
+	require.NoError(t, err)
+	require.Equal(t, []Drift{
+		{Kind: DriftUnexpected, Path: "upstream/extra/extra.proto"},
+		{Kind: DriftUnexpected, Path: "upstream/model/baz.proto"},
+		{Kind: DriftMissing, Path: "upstream/model/foo.proto", Target: "github.com/stormcat24/upstream/proto"},
+		{Kind: DriftModified, Path: "upstream/service.proto", Target: "github.com/stormcat24/upstream/proto"},
+	}, drifts)
+}
@@ -0,0 +1,187 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+type operator string
+
+const (
+	opEqual          operator = "="
+	opNotEqual       operator = "!="
+	opGreater        operator = ">"
+	opGreaterOrEqual operator = ">="
+	opLess           operator = "<"
+	opLessOrEqual    operator = "<="
+)
+
+type comparator struct {
+	op      operator
+	version *Version
+}
+
+func (c comparator) check(v *Version) bool {
+	r := v.Compare(c.version)
+	switch c.op {
+	case opEqual:
+		return r == 0
+	case opNotEqual:
+		return r != 0
+	case opGreater:
+		return r > 0
+	case opGreaterOrEqual:
+		return r >= 0
+	case opLess:
+		return r < 0
+	case opLessOrEqual:
+		return r <= 0
+	}
+	return false
+}
+
+// Constraint is a version range such as "^1.4.0", "~2.3" or ">=1.0, <2.0".
+// Comparators separated by "," must all match, and alternatives are separated by "||".
+type Constraint struct {
+	alternatives [][]comparator
+	prerelease   bool
+
+	original string
+}
+
+// ParseConstraint parses a version range. Supported comparators are "=", "!=", ">", ">=",
+// "<", "<=", "^" (compatible with) and "~" (same minor version). A version without an
+// operator must match exactly. Partial versions stand for every version they prefix, so
+// "1.2" is ">=1.2.0, <1.3.0", ">1.2" is ">=1.3.0" and "<=1.2" is "<1.3.0".
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{original: s}
+
+	for _, alternative := range strings.Split(s, "||") {
+		comparators := make([]comparator, 0)
+		for _, token := range strings.Split(alternative, ",") {
+			token = strings.TrimSpace(token)
+			if token == "" {
+				return nil, fmt.Errorf("invalid version constraint %q", s)
+			}
+
+			parsed, err := parseComparator(token)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+			}
+			// The version given by the user always comes first, followed by implied bounds.
+			if parsed[0].version.Prerelease != "" {
+				c.prerelease = true
+			}
+			comparators = append(comparators, parsed...)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+
+	return c, nil
+}
+
+func parseComparator(token string) ([]comparator, error) {
+	var op string
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(token, candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	v, err := Parse(strings.TrimSpace(strings.TrimPrefix(token, op)))
+	if err != nil {
+		return nil, err
+	}
+
+	if v.parts < 3 {
+		switch op {
+		case "", "=":
+			return []comparator{{opGreaterOrEqual, v}, {opLess, tildeUpperBound(v)}}, nil
+		case ">":
+			return []comparator{{opGreaterOrEqual, tildeUpperBound(v)}}, nil
+		case "<=":
+			return []comparator{{opLess, tildeUpperBound(v)}}, nil
+		case "!=":
+			return nil, fmt.Errorf("%q needs a full version", token)
+		}
+	}
+
+	switch op {
+	case "^":
+		return []comparator{{opGreaterOrEqual, v}, {opLess, caretUpperBound(v)}}, nil
+	case "~":
+		return []comparator{{opGreaterOrEqual, v}, {opLess, tildeUpperBound(v)}}, nil
+	case "":
+		return []comparator{{opEqual, v}}, nil
+	default:
+		return []comparator{{operator(op), v}}, nil
+	}
+}
+
+// caretUpperBound allows changes that do not modify the left-most non-zero number.
+func caretUpperBound(v *Version) *Version {
+	switch {
+	case v.Major > 0 || v.parts == 1:
+		return &Version{Major: v.Major + 1, Prerelease: "0"}
+	case v.Minor > 0 || v.parts == 2:
+		return &Version{Minor: v.Minor + 1, Prerelease: "0"}
+	default:
+		return &Version{Patch: v.Patch + 1, Prerelease: "0"}
+	}
+}
+
+// tildeUpperBound allows patch level changes, or minor changes when only the major is given.
+// It is also the first version after a partial version.
+func tildeUpperBound(v *Version) *Version {
+	if v.parts == 1 {
+		return &Version{Major: v.Major + 1, Prerelease: "0"}
+	}
+	return &Version{Major: v.Major, Minor: v.Minor + 1, Prerelease: "0"}
+}
+
+// Check reports whether v satisfies the constraint. Prereleases only match when the
+// constraint itself mentions a prerelease.
+func (c *Constraint) Check(v *Version) bool {
+	if v.Prerelease != "" && !c.prerelease {
+		return false
+	}
+
+	for _, comparators := range c.alternatives {
+		matched := true
+		for _, comparator := range comparators {
+			if !comparator.check(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Highest returns the highest tag satisfying the constraint, or an empty string when none does.
+func (c *Constraint) Highest(tags []string) string {
+	var highest *Version
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if highest == nil || v.Compare(highest) > 0 {
+			highest = v
+		}
+	}
+
+	if highest == nil {
+		return ""
+	}
+	return highest.String()
+}
+
+// String returns the string the constraint was parsed from.
+func (c *Constraint) String() string {
+	return c.original
+}
@@ -0,0 +1,63 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraintCheck(t *testing.T) {
+	cases := []struct {
+		constraint string
+		matches    []string
+		mismatches []string
+	}{
+		{"^1.4.0", []string{"v1.4.0", "v1.4.9", "v1.99.0"}, []string{"v1.3.9", "v2.0.0", "v2.0.0-rc.1", "v1.5.0-beta"}},
+		{"^0.3.1", []string{"v0.3.1", "v0.3.9"}, []string{"v0.4.0", "v0.3.0"}},
+		{"^0.0.3", []string{"v0.0.3"}, []string{"v0.0.4"}},
+		{"^1", []string{"v1.0.0", "v1.9.9"}, []string{"v2.0.0", "v0.9.0"}},
+		{"~2.3", []string{"v2.3.0", "v2.3.12"}, []string{"v2.4.0", "v2.2.9"}},
+		{"~2.3.4", []string{"v2.3.4", "v2.3.5"}, []string{"v2.3.3", "v2.4.0"}},
+		{"~2", []string{"v2.0.0", "v2.9.0"}, []string{"v3.0.0"}},
+		{">=1.0, <2.0", []string{"v1.0.0", "1.9.9"}, []string{"v2.0.0", "v0.9.9"}},
+		{"1.2.3", []string{"v1.2.3"}, []string{"v1.2.4"}},
+		{"1.2", []string{"v1.2.0", "v1.2.9"}, []string{"v1.3.0", "v1.1.9", "v1.3.0-rc.1"}},
+		{"=1", []string{"v1.0.0", "v1.9.0"}, []string{"v2.0.0", "v0.9.0"}},
+		{">1.2", []string{"v1.3.0", "v2.0.0"}, []string{"v1.2.5"}},
+		{"<=1.2", []string{"v1.2.9", "v1.0.0"}, []string{"v1.3.0"}},
+		{"!=1.2.3, ^1.2", []string{"v1.2.4"}, []string{"v1.2.3"}},
+		{"<1.0 || >=3.0", []string{"v0.5.0", "v3.1.0"}, []string{"v1.5.0"}},
+		{">=2.0.0-rc.1", []string{"v2.0.0-rc.2", "v2.0.0"}, []string{"v2.0.0-beta"}},
+	}
+
+	for _, tc := range cases {
+		c, err := ParseConstraint(tc.constraint)
+		require.NoError(t, err, tc.constraint)
+
+		for _, version := range tc.matches {
+			v, err := Parse(version)
+			require.NoError(t, err)
+			require.True(t, c.Check(v), "%s should match %s", version, tc.constraint)
+		}
+		for _, version := range tc.mismatches {
+			v, err := Parse(version)
+			require.NoError(t, err)
+			require.False(t, c.Check(v), "%s should not match %s", version, tc.constraint)
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, invalid := range []string{"", "^", ">=1.0,", "~latest", ">=1.0 <2.0", "!=1.2"} {
+		_, err := ParseConstraint(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestConstraintHighest(t *testing.T) {
+	c, err := ParseConstraint("^1.4.0")
+	require.NoError(t, err)
+
+	require.Equal(t, "v1.5.2", c.Highest([]string{"v1.3.0", "v1.4.0", "v1.5.2", "v2.0.0", "v1.6.0-rc.1", "latest"}))
+	require.Equal(t, "", c.Highest([]string{"v2.0.0", "v1.0.0"}))
+}
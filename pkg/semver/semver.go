@@ -0,0 +1,160 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version parsed from a tag such as "v1.2.3" or "1.2.3-rc.1".
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+
+	original string
+	// parts is the number of version numbers given, used to expand partial constraints.
+	parts int
+}
+
+// Parse parses a semantic version. A leading "v" is optional, and the minor and patch
+// numbers may be omitted ("v1", "1.2"). Build metadata ("+build") is ignored.
+func Parse(s string) (*Version, error) {
+	str := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if str == "" {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	if idx := strings.Index(str, "+"); idx >= 0 {
+		str = str[:idx]
+	}
+
+	var prerelease string
+	if idx := strings.Index(str, "-"); idx >= 0 {
+		prerelease = str[idx+1:]
+		str = str[:idx]
+		if prerelease == "" {
+			return nil, fmt.Errorf("invalid version %q: empty prerelease", s)
+		}
+	}
+
+	tokens := strings.Split(str, ".")
+	if len(tokens) > 3 {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	numbers := make([]int, 3)
+	for i, token := range tokens {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 0 || (len(token) > 1 && token[0] == '0') {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		numbers[i] = n
+	}
+
+	return &Version{
+		Major:      numbers[0],
+		Minor:      numbers[1],
+		Patch:      numbers[2],
+		Prerelease: prerelease,
+		original:   s,
+		parts:      len(tokens),
+	}, nil
+}
+
+// String returns the string the version was parsed from.
+func (v *Version) String() string {
+	return v.original
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or higher than o.
+func (v *Version) Compare(o *Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// Latest returns the highest semantic version in tags, skipping tags that are not versions.
+// Prereleases are only considered when no tag is a release. It returns an empty string when
+// no tag is a version.
+func Latest(tags []string) string {
+	var latest, latestPrerelease *Version
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil {
+			continue
+		}
+		if v.Prerelease != "" {
+			if latestPrerelease == nil || v.Compare(latestPrerelease) > 0 {
+				latestPrerelease = v
+			}
+		} else if latest == nil || v.Compare(latest) > 0 {
+			latest = v
+		}
+	}
+
+	if latest != nil {
+		return latest.String()
+	}
+	if latestPrerelease != nil {
+		return latestPrerelease.String()
+	}
+	return ""
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparePrerelease follows semver precedence: a version without prerelease is higher,
+// numeric identifiers compare numerically and are lower than alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareInt(len(as), len(bs))
+}
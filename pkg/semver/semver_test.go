@@ -0,0 +1,63 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse("v1.2.3")
+	require.NoError(t, err)
+	require.Equal(t, 1, v.Major)
+	require.Equal(t, 2, v.Minor)
+	require.Equal(t, 3, v.Patch)
+	require.Equal(t, "", v.Prerelease)
+	require.Equal(t, "v1.2.3", v.String())
+
+	v, err = Parse("2.3-rc.1+build.5")
+	require.NoError(t, err)
+	require.Equal(t, 2, v.Major)
+	require.Equal(t, 3, v.Minor)
+	require.Equal(t, 0, v.Patch)
+	require.Equal(t, "rc.1", v.Prerelease)
+
+	for _, invalid := range []string{"", "v", "master", "1.2.3.4", "v1.02.0", "1.2.x", "1.0.0-"} {
+		_, err := Parse(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.0.1",
+		"v1.10.0",
+		"v2.0.0",
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		lower, err := Parse(ordered[i])
+		require.NoError(t, err)
+		higher, err := Parse(ordered[i+1])
+		require.NoError(t, err)
+
+		require.Equal(t, -1, lower.Compare(higher), "%s < %s", ordered[i], ordered[i+1])
+		require.Equal(t, 1, higher.Compare(lower), "%s > %s", ordered[i+1], ordered[i])
+		require.Equal(t, 0, lower.Compare(lower))
+	}
+}
+
+func TestLatest(t *testing.T) {
+	require.Equal(t, "v1.10.0", Latest([]string{"v1.2.0", "v1.10.0", "latest", "v1.9.9", "v2.0.0-rc.1"}))
+	require.Equal(t, "v2.0.0-rc.2", Latest([]string{"v2.0.0-rc.1", "v2.0.0-rc.2"}))
+	require.Equal(t, "", Latest([]string{"master", "release"}))
+	require.Equal(t, "", Latest(nil))
+}